@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Error codes returned in APIError.Code. Clients switch on these; the
+// message is for people and may change.
+const (
+	ErrInvalidRequest        = "invalid_request"
+	ErrRequestTooLarge       = "request_too_large"
+	ErrMethodNotAllowed      = "method_not_allowed"
+	ErrNotFound              = "not_found"
+	ErrUnauthorized          = "unauthorized"
+	ErrForbidden             = "forbidden"
+	ErrUnknownTenant         = "unknown_tenant"
+	ErrRateLimited           = "rate_limited"
+	ErrFeatureDisabled       = "feature_disabled"
+	ErrNotEnabled            = "not_enabled"
+	ErrConflict              = "conflict"
+	ErrInternal              = "internal_server_error"
+	ErrUnavailable           = "service_unavailable"
+	ErrInvalidDate           = "invalid_date"
+	ErrNoEntries             = "no_entries"
+	ErrInvalidCSV            = "invalid_csv"
+	ErrTemplateNotFound      = "template_not_found"
+	ErrGenerationFailed      = "generation_failed"
+	ErrPDFFailed             = "pdf_generation_failed"
+	ErrEmailFailed           = "email_failed"
+	ErrQueueFull             = "queue_full"
+	ErrFileNotReady          = "file_not_ready"
+	ErrInvalidDownloadToken  = "invalid_download_token"
+	ErrTimecardApproved      = "timecard_already_approved"
+	ErrIdempotencyInProgress = "idempotency_key_in_progress"
+	ErrTimeout               = "timeout"
+	ErrRequestTimeout        = "request_timeout"
+	ErrPhotoURLNotAllowed    = "photo_url_not_allowed"
+)
+
+// APIError is the JSON body of every error response. Code is serialized as
+// "error" so clients that read the older {"error": "..."} bodies keep working.
+// ApprovedAt is only set on timecard_already_approved.
+type APIError struct {
+	Code       string     `json:"error"`
+	Message    string     `json:"message,omitempty"`
+	Details    []string   `json:"details,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+	RequestID  string     `json:"request_id,omitempty"`
+}
+
+// respondError writes apiErr as JSON with the given status, filling in the
+// request ID.
+func respondError(w http.ResponseWriter, r *http.Request, status int, apiErr APIError) {
+	ctx := r.Context()
+	apiErr.RequestID = requestIDFromContext(ctx)
+	slog.InfoContext(ctx, "error response", "status", status, "code", apiErr.Code, "message", apiErr.Message)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErr)
+}
+
+// decodeErrorCode pairs with decodeErrorStatus for request body errors.
+func decodeErrorCode(err error) string {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrRequestTooLarge
+	}
+	return ErrInvalidRequest
+}
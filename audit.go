@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// Audit actions recorded in audit_log.action.
+const (
+	AuditActionGenerate         = "generate_timecard"
+	AuditActionGeneratePDF      = "generate_pdf_timecard"
+	AuditActionEmail            = "email_timecard"
+	AuditActionGenerateAndEmail = "generate_and_email_timecard"
+)
+
+// auditDB is the audit log database (AUDIT_LOG_DB). Auditing is off when nil.
+var auditDB *sql.DB
+
+const auditSchema = `CREATE TABLE IF NOT EXISTS audit_log (
+	id TEXT PRIMARY KEY,
+	employee_name TEXT,
+	pay_period INT,
+	year INT,
+	action TEXT,
+	status TEXT,
+	client_ip TEXT,
+	subject TEXT,
+	request_id TEXT,
+	requested_at DATETIME,
+	completed_at DATETIME,
+	error TEXT,
+	chain_seq INTEGER,
+	chain_hash TEXT
+);
+CREATE INDEX IF NOT EXISTS audit_log_requested_at ON audit_log (requested_at);`
+
+// auditColumns are the columns added after the first schema, for logs
+// created by older versions.
+var auditColumns = []string{
+	"subject TEXT",
+	"chain_seq INTEGER",
+	"chain_hash TEXT",
+}
+
+func initAuditLog() {
+	path := os.Getenv("AUDIT_LOG_DB")
+	if path == "" {
+		return
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		slog.Error("audit log: could not open database", "path", path, "error", err)
+		return
+	}
+	// SQLite allows one writer at a time; a single connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(auditSchema); err != nil {
+		slog.Error("audit log: could not create schema", "path", path, "error", err)
+		db.Close()
+		return
+	}
+	// SQLite has no ADD COLUMN IF NOT EXISTS, so the duplicate column error
+	// is expected on every start after the first.
+	for _, column := range auditColumns {
+		if _, err := db.Exec("ALTER TABLE audit_log ADD COLUMN " + column); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			slog.Error("audit log: could not add column", "path", path, "column", column, "error", err)
+			db.Close()
+			return
+		}
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS audit_log_chain_seq ON audit_log (chain_seq)`); err != nil {
+		slog.Error("audit log: could not create schema", "path", path, "error", err)
+		db.Close()
+		return
+	}
+	auditDB = db
+	loadAuditChainSecret()
+	slog.Info("audit log enabled", "path", path)
+}
+
+// AuditEntry is one row of audit_log.
+type AuditEntry struct {
+	ID           string     `json:"id"`
+	EmployeeName string     `json:"employee_name"`
+	PayPeriod    int        `json:"pay_period"`
+	Year         int        `json:"year"`
+	Action       string     `json:"action"`
+	Status       string     `json:"status"`
+	ClientIP     string     `json:"client_ip"`
+	Subject      string     `json:"subject,omitempty"`
+	RequestID    string     `json:"request_id"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// auditStart records that a request began and returns the row ID to pass to
+// auditFinish. It returns "" when auditing is off or the insert fails; audit
+// problems are logged but never fail the request.
+func auditStart(r *http.Request, action string, req TimecardRequest) string {
+	if auditDB == nil || !features.EnableAuditLog {
+		return ""
+	}
+	ctx := r.Context()
+	id := uuid.New().String()
+	_, err := auditDB.ExecContext(ctx,
+		`INSERT INTO audit_log (id, employee_name, pay_period, year, action, status, client_ip, subject, request_id, requested_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, req.EmployeeName, req.PayPeriodNum, req.Year, action, JobStatusPending,
+		realIP(r, trustedProxies), authSubjectFromContext(ctx), requestIDFromContext(ctx), time.Now().UTC(),
+	)
+	if err != nil {
+		slog.WarnContext(ctx, "audit log: insert failed", "error", err)
+		return ""
+	}
+	return id
+}
+
+// auditFinish marks an audit row done or error.
+func auditFinish(ctx context.Context, id string, err error) {
+	if auditDB == nil || id == "" {
+		return
+	}
+	status, errText := JobStatusDone, ""
+	if err != nil {
+		status, errText = JobStatusError, err.Error()
+	}
+	// The request context may already be cancelled; the row should still close.
+	_, dbErr := auditDB.ExecContext(context.WithoutCancel(ctx),
+		`UPDATE audit_log SET status = ?, completed_at = ?, error = ? WHERE id = ?`,
+		status, time.Now().UTC(), errText, id,
+	)
+	if dbErr != nil {
+		slog.WarnContext(ctx, "audit log: update failed", "audit_id", id, "error", dbErr)
+		return
+	}
+	if err := auditChainAppend(context.WithoutCancel(ctx), id); err != nil {
+		slog.WarnContext(ctx, "audit log: chain append failed", "audit_id", id, "error", err)
+	}
+}
+
+// auditLogHandler handles GET /admin/audit-log?employee=&from=&to=&limit=&offset=.
+// from and to are inclusive YYYY-MM-DD dates.
+func auditLogHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	if auditDB == nil {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: "Audit log is not enabled"})
+		return
+	}
+	q := r.URL.Query()
+	query := `SELECT id, employee_name, pay_period, year, action, status, client_ip, subject, request_id,
+		requested_at, completed_at, error FROM audit_log WHERE 1 = 1`
+	var args []any
+	if employee := q.Get("employee"); employee != "" {
+		query += " AND employee_name = ?"
+		args = append(args, employee)
+	}
+	if from := q.Get("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidDate, Message: "Invalid request: from must be YYYY-MM-DD"})
+			return
+		}
+		query += " AND requested_at >= ?"
+		args = append(args, day)
+	}
+	if to := q.Get("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidDate, Message: "Invalid request: to must be YYYY-MM-DD"})
+			return
+		}
+		query += " AND requested_at < ?"
+		args = append(args, day.AddDate(0, 0, 1))
+	}
+	limit, offset := 50, 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: limit must be 1-500"})
+			return
+		}
+		limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: offset must be >= 0"})
+			return
+		}
+		offset = n
+	}
+	query += " ORDER BY requested_at DESC, id LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+	rows, err := auditDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "audit log: query failed", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading audit log"})
+		return
+	}
+	defer rows.Close()
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "audit log: scan failed", "error", err)
+			respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading audit log"})
+			return
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "audit log: query failed", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading audit log"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"entries": entries,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+func scanAuditEntry(rows *sql.Rows) (AuditEntry, error) {
+	var entry AuditEntry
+	var completedAt sql.NullTime
+	var subject, errText sql.NullString
+	err := rows.Scan(&entry.ID, &entry.EmployeeName, &entry.PayPeriod, &entry.Year, &entry.Action,
+		&entry.Status, &entry.ClientIP, &subject, &entry.RequestID, &entry.RequestedAt, &completedAt, &errText)
+	entry.Subject = subject.String
+	if completedAt.Valid {
+		entry.CompletedAt = &completedAt.Time
+	}
+	entry.Error = errText.String
+	return entry, err
+}
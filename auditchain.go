@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditChainSecret (AUDIT_LOG_ROOT_SECRET) keys the HMAC chain over
+// audit_log rows. Rows are not chained when it is empty.
+var auditChainSecret []byte
+
+// auditChainMu serialises appends so each row chains from the one before.
+var auditChainMu sync.Mutex
+
+func loadAuditChainSecret() {
+	auditChainSecret = []byte(os.Getenv("AUDIT_LOG_ROOT_SECRET"))
+	if len(auditChainSecret) == 0 {
+		slog.Info("AUDIT_LOG_ROOT_SECRET not set, audit log rows are not chained")
+	}
+}
+
+// auditChainHash is hex(HMAC-SHA256(prev || id || employee_name || action ||
+// status || requested_at)). Each field is followed by a NUL byte so text
+// can't move between adjacent fields without changing the hash.
+func auditChainHash(prev, id, employeeName, action, status string, requestedAt time.Time) string {
+	mac := hmac.New(sha256.New, auditChainSecret)
+	for _, field := range []string{prev, id, employeeName, action, status, requestedAt.UTC().Format(time.RFC3339Nano)} {
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// auditChainAppend links a finished row onto the end of the chain. Rows
+// are chained when they finish rather than when inserted so the hash
+// covers the final status; chain_seq records the chain order.
+func auditChainAppend(ctx context.Context, id string) error {
+	if len(auditChainSecret) == 0 {
+		return nil
+	}
+	auditChainMu.Lock()
+	defer auditChainMu.Unlock()
+	var prevSeq int64
+	var prevHash string
+	err := auditDB.QueryRowContext(ctx,
+		`SELECT chain_seq, chain_hash FROM audit_log WHERE chain_seq IS NOT NULL ORDER BY chain_seq DESC LIMIT 1`,
+	).Scan(&prevSeq, &prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	var employeeName, action, status string
+	var requestedAt time.Time
+	err = auditDB.QueryRowContext(ctx,
+		`SELECT employee_name, action, status, requested_at FROM audit_log WHERE id = ?`, id,
+	).Scan(&employeeName, &action, &status, &requestedAt)
+	if err != nil {
+		return err
+	}
+	hash := auditChainHash(prevHash, id, employeeName, action, status, requestedAt)
+	_, err = auditDB.ExecContext(ctx,
+		`UPDATE audit_log SET chain_seq = ?, chain_hash = ? WHERE id = ? AND chain_seq IS NULL`,
+		prevSeq+1, hash, id,
+	)
+	return err
+}
+
+// auditVerifyHandler handles GET /admin/audit-log/verify. It replays the
+// chain from its first row and reports the chain_seq of the first row whose
+// hash doesn't match, which is also where a deleted row shows up.
+func auditVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if auditDB == nil || len(auditChainSecret) == 0 {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: "Audit log chaining is not enabled"})
+		return
+	}
+	// Hold the append lock so a row finishing mid-replay isn't half-seen.
+	auditChainMu.Lock()
+	defer auditChainMu.Unlock()
+	rows, err := auditDB.QueryContext(ctx,
+		`SELECT chain_seq, chain_hash, id, employee_name, action, status, requested_at
+		 FROM audit_log WHERE chain_seq IS NOT NULL ORDER BY chain_seq`)
+	if err != nil {
+		slog.ErrorContext(ctx, "audit log: verify query failed", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading audit log"})
+		return
+	}
+	defer rows.Close()
+	prev := ""
+	var expected int64 = 1
+	for ; rows.Next(); expected++ {
+		var seq int64
+		var hash, id, employeeName, action, status string
+		var requestedAt time.Time
+		if err := rows.Scan(&seq, &hash, &id, &employeeName, &action, &status, &requestedAt); err != nil {
+			slog.ErrorContext(ctx, "audit log: verify scan failed", "error", err)
+			respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading audit log"})
+			return
+		}
+		want := auditChainHash(prev, id, employeeName, action, status, requestedAt)
+		if seq != expected || !hmac.Equal([]byte(hash), []byte(want)) {
+			slog.WarnContext(ctx, "audit log: chain broken", "chain_seq", expected, "audit_id", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"valid": false, "first_tampered_row": expected})
+			return
+		}
+		prev = hash
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "audit log: verify query failed", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading audit log"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"valid": true, "rows": expected - 1})
+}
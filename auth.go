@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AUTH_TYPE values. api_key checks API_TOKENS/ADMIN_TOKENS; jwt verifies
+// RS256/384/512 tokens against JWT_PUBLIC_KEY_FILE.
+const (
+	authTypeAPIKey = "api_key"
+	authTypeJWT    = "jwt"
+)
+
+// JWT scopes, granted as a space-separated "scope" claim.
+const (
+	scopeGenerate = "generate"
+	scopeEmail    = "email"
+	scopeAdmin    = "admin"
+)
+
+// authType is the AUTH_TYPE in effect.
+var authType = authTypeAPIKey
+
+// jwtPublicKey verifies bearer tokens when authType is jwt.
+var jwtPublicKey *rsa.PublicKey
+
+// routeScopes maps unversioned paths to the JWT scope they require. A key
+// may start with a method where one path serves both reads and writes.
+// Every route that sends mail needs email and every other route that builds
+// a workbook or PDF needs generate. Routes not listed need only a valid
+// token; /admin/* always needs admin.
+var routeScopes = map[string]string{
+	"/api/generate-timecard":           scopeGenerate,
+	"/api/generate-pdf-timecard":       scopeGenerate,
+	"/api/generate-expense-mileage":    scopeGenerate,
+	"/api/batch-generate":              scopeGenerate,
+	"POST /api/jobs":                   scopeGenerate,
+	"/api/email-timecard":              scopeEmail,
+	"/api/generate-and-email-timecard": scopeEmail,
+	"/api/bulk-email":                  scopeEmail,
+}
+
+// jwtClaims are the claims read from a bearer token.
+type jwtClaims struct {
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// hasScope reports whether the space-separated scope claim grants scope.
+func (c *jwtClaims) hasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+type jwtClaimsKey struct{}
+
+// authSubjectFromContext returns the JWT subject of the caller, or "" under
+// API key auth.
+func authSubjectFromContext(ctx context.Context) string {
+	if claims, _ := ctx.Value(jwtClaimsKey{}).(*jwtClaims); claims != nil {
+		return claims.Subject
+	}
+	return ""
+}
+
+// apiTokens holds the opaque bearer tokens accepted on /api/* and /admin/* routes,
+// loaded from the comma-separated API_TOKENS env var. Auth is disabled when empty.
+var apiTokens [][]byte
+
+// adminTokens (ADMIN_TOKENS) are the subset of bearer tokens allowed to call
+// admin-only actions such as approving timecards. When empty, any accepted API
+// token may call them.
+var adminTokens [][]byte
+
+// loadAPITokens reads AUTH_TYPE and the tokens or public key it needs. An
+// error means the server must not start: falling back to no auth would
+// open every route.
+func loadAPITokens() error {
+	switch authType = strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_TYPE"))); authType {
+	case "", authTypeAPIKey:
+		authType = authTypeAPIKey
+	case authTypeJWT:
+		return loadJWTPublicKey()
+	default:
+		return fmt.Errorf("AUTH_TYPE must be %s or %s, got %q", authTypeAPIKey, authTypeJWT, authType)
+	}
+	apiTokens = nil
+	for _, token := range splitAndTrim(os.Getenv("API_TOKENS")) {
+		apiTokens = append(apiTokens, []byte(token))
+	}
+	adminTokens = nil
+	for _, token := range splitAndTrim(os.Getenv("ADMIN_TOKENS")) {
+		adminTokens = append(adminTokens, []byte(token))
+	}
+	if len(apiTokens) == 0 {
+		slog.Warn("API_TOKENS not set, /api and /admin routes are unauthenticated")
+		return nil
+	}
+	slog.Info("API token auth enabled", "tokens", len(apiTokens), "admin_tokens", len(adminTokens))
+	return nil
+}
+
+func loadJWTPublicKey() error {
+	path := os.Getenv("JWT_PUBLIC_KEY_FILE")
+	if path == "" {
+		return fmt.Errorf("AUTH_TYPE=jwt requires JWT_PUBLIC_KEY_FILE")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading JWT public key: %w", err)
+	}
+	key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+	if err != nil {
+		return fmt.Errorf("parsing JWT public key %s: %w", path, err)
+	}
+	jwtPublicKey = key
+	slog.Info("JWT auth enabled", "public_key_file", path, "key_bits", key.N.BitLen())
+	return nil
+}
+
+// parseJWT verifies the signature and expiry of a bearer token. Only RSA
+// algorithms are accepted so a token can't pick HS256 with the public key
+// as its secret.
+func parseJWT(token string) (*jwtClaims, error) {
+	claims := &jwtClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return jwtPublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// requiredScope returns the JWT scope a request needs, or "" when any valid
+// token will do.
+func requiredScope(method, path string) string {
+	path = strings.TrimPrefix(path, "/v"+apiVersion)
+	if strings.HasPrefix(path, "/admin/") {
+		return scopeAdmin
+	}
+	if scope, ok := routeScopes[method+" "+path]; ok {
+		return scope
+	}
+	return routeScopes[path]
+}
+
+// isPublicPath reports whether a path is exempt from token auth (health and metrics probes).
+func isPublicPath(path string) bool {
+	return path == "/health" || path == "/metrics" || strings.HasPrefix(path, "/healthz/")
+}
+
+// authMiddleware rejects requests that don't carry a configured bearer token.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if authType == authTypeJWT {
+			jwtAuth(next, w, r)
+			return
+		}
+		if len(apiTokens) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header := r.Header.Get("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || !validToken([]byte(strings.TrimSpace(token)), apiTokens) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="timecard-api"`)
+			respondError(w, r, http.StatusUnauthorized, APIError{Code: ErrUnauthorized, Message: "Missing or invalid bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jwtAuth answers 401 for a missing, invalid or expired token and 403 when
+// the token lacks the scope the route requires. The claims are stored on the
+// request context for requireAdmin and the audit log.
+func jwtAuth(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="timecard-api"`)
+		respondError(w, r, http.StatusUnauthorized, APIError{Code: ErrUnauthorized, Message: "Missing or invalid bearer token"})
+		return
+	}
+	claims, err := parseJWT(strings.TrimSpace(token))
+	if err != nil {
+		slog.InfoContext(r.Context(), "rejected bearer token", "error", err)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="timecard-api", error="invalid_token"`)
+		respondError(w, r, http.StatusUnauthorized, APIError{Code: ErrUnauthorized, Message: "Missing or invalid bearer token"})
+		return
+	}
+	if scope := requiredScope(r.Method, r.URL.Path); scope != "" && !claims.hasScope(scope) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="timecard-api", error="insufficient_scope", scope=%q`, scope))
+		respondError(w, r, http.StatusForbidden, APIError{Code: ErrForbidden, Message: fmt.Sprintf("This endpoint requires the %s scope", scope)})
+		return
+	}
+	ctx := context.WithValue(r.Context(), jwtClaimsKey{}, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireAdmin restricts a handler to ADMIN_TOKENS, or to tokens with the
+// admin scope under JWT auth. It runs inside authMiddleware, so it only
+// decides between admin and ordinary tokens.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authType == authTypeJWT {
+			if claims, _ := r.Context().Value(jwtClaimsKey{}).(*jwtClaims); claims == nil || !claims.hasScope(scopeAdmin) {
+				respondError(w, r, http.StatusForbidden, APIError{Code: ErrForbidden, Message: "This endpoint requires the admin scope"})
+				return
+			}
+		} else if len(adminTokens) > 0 {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !validToken([]byte(strings.TrimSpace(token)), adminTokens) {
+				respondError(w, r, http.StatusForbidden, APIError{Code: ErrForbidden, Message: "This endpoint requires an admin token"})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// validToken compares against every candidate so timing doesn't reveal which
+// (if any) token matched.
+func validToken(token []byte, candidates [][]byte) bool {
+	matched := 0
+	for _, candidate := range candidates {
+		matched |= subtle.ConstantTimeCompare(token, candidate)
+	}
+	return matched == 1
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxBatchSize caps the number of timecards accepted by one batch request.
+const maxBatchSize = 50
+
+// BatchGenerateRequest is the body of POST /api/batch-generate.
+type BatchGenerateRequest struct {
+	Requests []TimecardRequest `json:"requests"`
+}
+
+// BatchResult reports the outcome of one timecard in a batch. Successful results
+// link to the generated workbook, which is kept for the async job TTL.
+type BatchResult struct {
+	Index       int      `json:"index"`
+	Status      string   `json:"status"`
+	DownloadURL string   `json:"download_url,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// batchGenerateHandler generates every timecard in the batch concurrently using
+// BATCH_WORKER_COUNT workers (default 4), each waiting for a generatePool slot
+// per item. A failure in one item never fails the batch: the response is
+// always 200 with a result per item.
+func batchGenerateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var batch BatchGenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		slog.WarnContext(ctx, "error decoding batch request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if len(batch.Requests) == 0 {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: requests must not be empty"})
+		return
+	}
+	if len(batch.Requests) > maxBatchSize {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: fmt.Sprintf("Invalid request: at most %d requests per batch", maxBatchSize)})
+		return
+	}
+	workers := getEnvInt("BATCH_WORKER_COUNT", 4)
+	if workers < 1 {
+		workers = 1
+	}
+	start := time.Now()
+	slog.InfoContext(ctx, "generating batch", "items", len(batch.Requests), "workers", workers)
+	results := make([]BatchResult, len(batch.Requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				err := generatePool.Do(ctx, func() {
+					results[idx] = generateBatchItem(ctx, idx, batch.Requests[idx])
+				})
+				if err != nil {
+					results[idx] = BatchResult{Index: idx, Status: JobStatusError, Error: err.Error()}
+				}
+			}
+		}()
+	}
+	for idx := range batch.Requests {
+		indexes <- idx
+	}
+	close(indexes)
+	wg.Wait()
+	failed := 0
+	for _, result := range results {
+		if result.Status == JobStatusError {
+			failed++
+		}
+	}
+	slog.InfoContext(ctx, "generated batch",
+		"items", len(results),
+		"failed", failed,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": results})
+}
+
+// generateBatchItem validates and builds one batch workbook and stores it as
+// a completed job so it can be fetched from /api/files/{id}/excel. An invalid
+// item fails on its own without affecting the rest of the batch.
+func generateBatchItem(ctx context.Context, idx int, req TimecardRequest) BatchResult {
+	result := BatchResult{Index: idx}
+	if len(req.Entries) == 0 && len(req.Weeks) == 0 {
+		result.Warnings = append(result.Warnings, "request has no entries")
+	}
+	if errs := validateTimecardRequest(req); len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, e := range errs {
+			messages[i] = e.Message
+		}
+		result.Status = JobStatusError
+		result.Error = "Invalid request: " + strings.Join(messages, "; ")
+		return result
+	}
+	excelData, err := buildTimecardWorkbook(ctx, req)
+	if err != nil {
+		slog.WarnContext(ctx, "batch item failed", "index", idx, "employee_name", req.EmployeeName, "error", err)
+		result.Status = JobStatusError
+		result.Error = err.Error()
+		return result
+	}
+	now := time.Now()
+	status := &JobStatus{
+		ID:           uuid.New().String(),
+		TenantID:     tenantIDFromContext(ctx),
+		Status:       JobStatusDone,
+		EmployeeName: req.EmployeeName,
+		ExcelData:    excelData,
+		CreatedAt:    now,
+		CompletedAt:  now,
+	}
+	jobStatuses.Store(status.ID, status)
+	result.Status = JobStatusDone
+	result.DownloadURL = jobDownloadURL(status.ID)
+	return result
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BulkEmailRequest is the body of POST /api/bulk-email. Each recipient carries
+// a full timecard plus the usual email fields.
+type BulkEmailRequest struct {
+	Recipients []GenerateAndEmailRequest `json:"recipients"`
+}
+
+// BulkEmailResult reports the outcome for one recipient of a bulk email.
+type BulkEmailResult struct {
+	To       string   `json:"to"`
+	Status   string   `json:"status"`
+	EmailID  string   `json:"email_id,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Bulk email result statuses.
+const (
+	BulkEmailSent  = "sent"
+	BulkEmailError = "error"
+)
+
+// bulkEmailHandler handles POST /api/bulk-email: it generates and emails each
+// recipient's timecard, EMAIL_PARALLELISM (default 4) at a time, each under its
+// own EMAIL_TIMEOUT_SECONDS. One failed recipient never fails the others: the
+// response is always 200 with a result per recipient, in request order.
+func bulkEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var bulk BulkEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&bulk); err != nil {
+		slog.WarnContext(ctx, "error decoding bulk email request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if len(bulk.Recipients) == 0 {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: recipients must not be empty"})
+		return
+	}
+	if len(bulk.Recipients) > maxBatchSize {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: fmt.Sprintf("Invalid request: at most %d recipients per request", maxBatchSize)})
+		return
+	}
+	parallelism := max(getEnvInt("EMAIL_PARALLELISM", 4), 1)
+	start := time.Now()
+	slog.InfoContext(ctx, "sending bulk email", "recipients", len(bulk.Recipients), "parallelism", parallelism)
+	results := make([]BulkEmailResult, len(bulk.Recipients))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, recipient := range bulk.Recipients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = emailBulkRecipient(ctx, r, recipient)
+		}()
+	}
+	wg.Wait()
+	failed := 0
+	for _, result := range results {
+		if result.Status == BulkEmailError {
+			failed++
+		}
+	}
+	slog.InfoContext(ctx, "sent bulk email",
+		"recipients", len(results),
+		"failed", failed,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// emailBulkRecipient validates, generates and emails one recipient's timecard.
+func emailBulkRecipient(ctx context.Context, r *http.Request, req GenerateAndEmailRequest) BulkEmailResult {
+	result := BulkEmailResult{To: req.To, Status: BulkEmailError}
+	errs := validateTimecardRequest(req.TimecardRequest)
+	if len(splitAndTrim(req.To)) == 0 {
+		errs = append(errs, ValidationError{Field: "to", Code: ValidationRequired, Message: "to is required"})
+	}
+	if len(errs) > 0 {
+		messages := make([]string, len(errs))
+		for i, e := range errs {
+			messages[i] = e.Message
+		}
+		result.Error = "Invalid request: " + strings.Join(messages, "; ")
+		return result
+	}
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout())
+	defer cancel()
+	record := newEmailRecord(ctx, req.To, req.Subject)
+	result.EmailID = record.ID
+	resp, _, err := generateAndEmail(ctx, r, req, record)
+	result.Warnings = resp.Warnings
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = BulkEmailSent
+	return result
+}
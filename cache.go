@@ -0,0 +1,190 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// workbookCache holds recently generated timecards keyed by ETag so a client
+// re-submitting an identical request gets a 304 or the cached bytes instead of
+// a fresh render.
+var workbookCache *lruCache
+
+func initWorkbookCache() {
+	maxEntries := getEnvInt("CACHE_MAX_ENTRIES", 100)
+	ttl := time.Duration(getEnvInt("CACHE_TTL_SECONDS", 300)) * time.Second
+	workbookCache = newLRUCache(maxEntries, ttl)
+	slog.Info("workbook cache configured", "max_entries", maxEntries, "ttl", ttl.String())
+}
+
+// timecardETag returns a strong ETag for req. encoding/json writes struct fields
+// in declaration order, so re-marshalling the decoded request gives a canonical
+// form that ignores whitespace and key order in the original body. The tenant
+// is part of the key because tenants render with different templates.
+func timecardETag(tenant *TenantConfig, req TimecardRequest) (string, error) {
+	canonical, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if tenant != nil {
+		h.Write([]byte(tenant.ID + "\x00"))
+	}
+	h.Write(canonical)
+	return fmt.Sprintf("\"%x\"", h.Sum(nil)), nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// lruCache is a fixed-size, TTL-bounded LRU. A nil cache or one with
+// maxEntries <= 0 stores nothing.
+type lruCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	order      *list.List
+	items      map[string]*list.Element
+}
+
+func newLRUCache(maxEntries int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) Get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *lruCache) Add(key string, value []byte) {
+	if c == nil || c.maxEntries <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Purge drops every entry. SIGHUP calls it after reloading templates, since
+// the ETag covers the request but not the template it was rendered with.
+func (c *lruCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.items)
+}
+
+// cacheResult says how serveCachedTimecard answered.
+type cacheResult int
+
+const (
+	cacheMiss        cacheResult = iota // nothing written
+	cacheNotModified                    // 304, no body
+	cacheHit                            // cached bytes sent
+)
+
+// serveCachedTimecard answers from the cache when possible: 304 if the client
+// already holds the current version, otherwise the cached bytes. On a hit it
+// also returns the storage key writeTimecardFile used.
+func serveCachedTimecard(w http.ResponseWriter, r *http.Request, etag string, req TimecardRequest) (string, cacheResult) {
+	data, ok := workbookCache.Get(etag)
+	if !ok {
+		return "", cacheMiss
+	}
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		slog.DebugContext(r.Context(), "timecard cache: not modified", "etag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return "", cacheNotModified
+	}
+	slog.DebugContext(r.Context(), "timecard cache: hit", "etag", etag)
+	return writeTimecardFile(w, r, req, data, "xlsx", xlsxContentType), cacheHit
+}
+
+// workbookFlight collapses concurrent builds of the same timecard, keyed by
+// ETag, into one.
+var workbookFlight singleflight.Group
+
+// buildTimecardWorkbookShared builds req's workbook, sharing the result with
+// any identical request already being built. The build is detached from ctx
+// so one caller giving up doesn't fail the others; a caller whose ctx ends
+// stops waiting. The returned bytes are shared and must not be modified.
+func buildTimecardWorkbookShared(ctx context.Context, etag string, req TimecardRequest) ([]byte, error) {
+	if etag == "" {
+		return buildTimecardWorkbook(ctx, req)
+	}
+	results := workbookFlight.DoChan(etag, func() (any, error) {
+		return buildTimecardWorkbook(context.WithoutCancel(ctx), req)
+	})
+	select {
+	case res := <-results:
+		if res.Shared {
+			slog.DebugContext(ctx, "timecard build shared", "etag", etag)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// uploadsDir holds files written to disk by the service. It may not exist.
+const uploadsDir = "uploads"
+
+// tempFilePatterns matches the os.CreateTemp names this service uses, so the
+// sweeper never touches other processes' files in the shared temp dir.
+var tempFilePatterns = []string{"logo_*.png"}
+
+// initFileCleanup starts a goroutine that deletes generated and temp files older
+// than FILE_TTL_MINUTES (default 60), checking every TTL/2. Files are normally
+// removed as soon as they're used; this catches anything left behind by a crash
+// or a failed request.
+func initFileCleanup() {
+	ttl := time.Duration(getEnvInt("FILE_TTL_MINUTES", 60)) * time.Minute
+	if ttl <= 0 {
+		slog.Info("file cleanup disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+		for range ticker.C {
+			cleanupOldFiles(ttl)
+		}
+	}()
+}
+
+func cleanupOldFiles(ttl time.Duration) {
+	cutoff := time.Now().Add(-ttl)
+	var files int
+	var freed int64
+	remove := func(path string, info fs.FileInfo) {
+		if info.ModTime().After(cutoff) {
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Warn("file cleanup: could not remove file", "path", path, "error", err)
+			return
+		}
+		slog.Debug("file cleanup: removed file", "path", path, "age", time.Since(info.ModTime()).Round(time.Second).String())
+		files++
+		freed += info.Size()
+	}
+	err := filepath.WalkDir(uploadsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed since the walk started
+		}
+		remove(path, info)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("file cleanup: could not walk uploads", "dir", uploadsDir, "error", err)
+	}
+	for _, pattern := range tempFilePatterns {
+		matches, _ := filepath.Glob(filepath.Join(os.TempDir(), pattern))
+		for _, path := range matches {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				remove(path, info)
+			}
+		}
+	}
+	if files > 0 {
+		slog.Info(fmt.Sprintf("cleaned %d files, freed %.1f MB", files, float64(freed)/(1<<20)),
+			"files", files,
+			"bytes", freed,
+		)
+	}
+}
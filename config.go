@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"timecard-api/internal/email"
+)
+
+// Config is the merged server configuration. Plain settings mirror the env vars
+// of the same name (see the env tags); CONFIG_FILE may set any of them in YAML
+// and the env var wins when both are set. The structured settings at the end
+// only exist in the file.
+type Config struct {
+	Port            string `yaml:"port" env:"PORT"`
+	LogLevel        string `yaml:"log_level" env:"LOG_LEVEL"`
+	LogFile         string `yaml:"log_file" env:"LOG_FILE"`
+	MaxRequestBytes string `yaml:"max_request_bytes" env:"MAX_REQUEST_BYTES" kind:"int"`
+	EnableMetrics   string `yaml:"enable_metrics" env:"ENABLE_METRICS" kind:"bool"`
+	FeatureFlags    string `yaml:"feature_flags" env:"FEATURE_FLAGS"`
+	PDFConverters   string `yaml:"pdf_converters" env:"PDF_CONVERTERS"`
+	PanicWebhookURL string `yaml:"panic_webhook_url" env:"PANIC_WEBHOOK_URL" secret:"true"`
+
+	OTLPEndpoint     string `yaml:"otel_exporter_otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	EnablePprof      string `yaml:"enable_pprof" env:"ENABLE_PPROF" kind:"bool"`
+	AdminAllowedCIDR string `yaml:"admin_allowed_cidr" env:"ADMIN_ALLOWED_CIDR"`
+
+	APITokens             string `yaml:"api_tokens" env:"API_TOKENS" secret:"true"`
+	AdminTokens           string `yaml:"admin_tokens" env:"ADMIN_TOKENS" secret:"true"`
+	AdminMasterKey        string `yaml:"admin_master_key" env:"ADMIN_MASTER_KEY" secret:"true"`
+	AuthType              string `yaml:"auth_type" env:"AUTH_TYPE"`
+	JWTPublicKeyFile      string `yaml:"jwt_public_key_file" env:"JWT_PUBLIC_KEY_FILE"`
+	DownloadSigningSecret string `yaml:"download_signing_secret" env:"DOWNLOAD_SIGNING_SECRET" secret:"true"`
+	DownloadURLTTLMinutes string `yaml:"download_url_ttl_minutes" env:"DOWNLOAD_URL_TTL_MINUTES" kind:"int"`
+	RateLimitRPS          string `yaml:"rate_limit_rps" env:"RATE_LIMIT_RPS" kind:"float"`
+	RateLimitBurst        string `yaml:"rate_limit_burst" env:"RATE_LIMIT_BURST" kind:"int"`
+	TrustedProxies        string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	WorkerPoolSize   string `yaml:"worker_pool_size" env:"WORKER_POOL_SIZE" kind:"int"`
+	JobTTLMinutes    string `yaml:"job_ttl_minutes" env:"JOB_TTL_MINUTES" kind:"int"`
+	BatchWorkerCount string `yaml:"batch_worker_count" env:"BATCH_WORKER_COUNT" kind:"int"`
+	CacheMaxEntries  string `yaml:"cache_max_entries" env:"CACHE_MAX_ENTRIES" kind:"int"`
+	CacheTTLSeconds  string `yaml:"cache_ttl_seconds" env:"CACHE_TTL_SECONDS" kind:"int"`
+	FileTTLMinutes   string `yaml:"file_ttl_minutes" env:"FILE_TTL_MINUTES" kind:"int"`
+
+	StorageBackend         string `yaml:"storage_backend" env:"STORAGE_BACKEND"`
+	S3Bucket               string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	PresignedURLTTLMinutes string `yaml:"presigned_url_ttl_minutes" env:"PRESIGNED_URL_TTL_MINUTES" kind:"int"`
+	AuditLogDB             string `yaml:"audit_log_db" env:"AUDIT_LOG_DB"`
+	AuditLogRootSecret     string `yaml:"audit_log_root_secret" env:"AUDIT_LOG_ROOT_SECRET" secret:"true"`
+	DatabaseURL            string `yaml:"database_url" env:"DATABASE_URL" secret:"true"`
+	RedisURL               string `yaml:"redis_url" env:"REDIS_URL" secret:"true"`
+
+	JobsFile              string `yaml:"jobs_file" env:"JOBS_FILE"`
+	ScheduleTemplatesFile string `yaml:"schedule_templates_file" env:"SCHEDULE_TEMPLATES_FILE"`
+	TenantsDir            string `yaml:"tenants_dir" env:"TENANTS_DIR"`
+	FirstPayPeriodStart   string `yaml:"first_pay_period_start" env:"FIRST_PAY_PERIOD_START" kind:"date"`
+	PayPeriodLengthDays   string `yaml:"pay_period_length_days" env:"PAY_PERIOD_LENGTH_DAYS" kind:"int"`
+	JobStartHour          string `yaml:"job_start_hour" env:"JOB_START_HOUR" kind:"int"`
+
+	SMTPHost               string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort               string `yaml:"smtp_port" env:"SMTP_PORT" kind:"int"`
+	SMTPUser               string `yaml:"smtp_user" env:"SMTP_USER"`
+	SMTPPass               string `yaml:"smtp_pass" env:"SMTP_PASS" secret:"true"`
+	SMTPFrom               string `yaml:"smtp_from" env:"SMTP_FROM"`
+	SMTPFromName           string `yaml:"smtp_from_name" env:"SMTP_FROM_NAME"`
+	SMTPMaxRetries         string `yaml:"smtp_max_retries" env:"SMTP_MAX_RETRIES" kind:"int"`
+	SMTPTLSMode            string `yaml:"smtp_tls_mode" env:"SMTP_TLS_MODE"`
+	EmailTimeoutSeconds    string `yaml:"email_timeout_seconds" env:"EMAIL_TIMEOUT_SECONDS" kind:"int"`
+	GenerateTimeoutSeconds string `yaml:"generate_timeout_seconds" env:"GENERATE_TIMEOUT_SECONDS" kind:"int"`
+	EmailRecordTTLMinutes  string `yaml:"email_record_ttl_minutes" env:"EMAIL_RECORD_TTL_MINUTES" kind:"int"`
+	EmailParallelism       string `yaml:"email_parallelism" env:"EMAIL_PARALLELISM" kind:"int"`
+	SMTPAuthType           string `yaml:"smtp_auth_type" env:"SMTP_AUTH_TYPE"`
+	SMTPOAuth2RefreshToken string `yaml:"smtp_oauth2_refresh_token" env:"SMTP_OAUTH2_REFRESH_TOKEN" secret:"true"`
+	SMTPOAuth2TokenURL     string `yaml:"smtp_oauth2_token_url" env:"SMTP_OAUTH2_TOKEN_URL"`
+	SMTPOAuth2ClientID     string `yaml:"smtp_oauth2_client_id" env:"SMTP_OAUTH2_CLIENT_ID"`
+	SMTPOAuth2ClientSecret string `yaml:"smtp_oauth2_client_secret" env:"SMTP_OAUTH2_CLIENT_SECRET" secret:"true"`
+
+	// TemplateDir holds template.xlsx and expense_mileage_template.xlsx.
+	TemplateDir string `yaml:"template_dir"`
+	// SheetLayout overrides the row positions of the timecard template.
+	SheetLayout SheetLayout `yaml:"sheet_layout"`
+	// TenantConfigs defines tenants inline, alongside any in TENANTS_DIR.
+	TenantConfigs map[string]*TenantConfig `yaml:"tenant_configs"`
+}
+
+// SheetLayout describes where fillWeekSheet writes on each week sheet. Each
+// section has a header row for the labour codes and job numbers and seven day
+// rows from its start row. It is read from CONFIG_FILE's sheet_layout and then
+// from template_config.json in TemplateDir, which wins.
+type SheetLayout struct {
+	RegularHeaderRow  int `yaml:"regular_header_row" json:"regular_header_row"`
+	RegularStartRow   int `yaml:"regular_start_row" json:"regular_start_row"`
+	OvertimeHeaderRow int `yaml:"overtime_header_row" json:"overtime_header_row"`
+	OvertimeStartRow  int `yaml:"overtime_start_row" json:"overtime_start_row"`
+	// Templates with a separate night shift section set these; at 0 regular
+	// night hours share the regular section with an "N" labour code.
+	NightShiftHeaderRow int `yaml:"night_shift_header_row" json:"night_shift_header_row"`
+	NightShiftStartRow  int `yaml:"night_shift_start_row" json:"night_shift_start_row"`
+	// Total rows default to the row after each section's last day. In the
+	// regular section the row after the total holds its night hours.
+	RegularTotalRow    int `yaml:"regular_total_row" json:"regular_total_row"`
+	NightShiftTotalRow int `yaml:"night_shift_total_row" json:"night_shift_total_row"`
+	OvertimeTotalRow   int `yaml:"overtime_total_row" json:"overtime_total_row"`
+
+	// Print setup. An empty PrintArea uses the sheet's used range and a
+	// FreezeRow of 0 leaves the panes unfrozen.
+	Orientation string `yaml:"orientation" json:"orientation"`
+	PaperSize   int    `yaml:"paper_size" json:"paper_size"`
+	PrintArea   string `yaml:"print_area" json:"print_area"`
+	FreezeRow   int    `yaml:"freeze_row" json:"freeze_row"`
+
+	// EmployeePhotoCell anchors the photo fetched from employee_photo_url.
+	EmployeePhotoCell string `yaml:"employee_photo_cell" json:"employee_photo_cell"`
+}
+
+// defaultSheetLayout matches template.xlsx.
+var defaultSheetLayout = SheetLayout{
+	RegularHeaderRow:  4,
+	RegularStartRow:   5,
+	OvertimeHeaderRow: 15,
+	OvertimeStartRow:  16,
+	Orientation:       "landscape",
+	PaperSize:         1, // Letter
+	PrintArea:         "A1:AL30",
+	FreezeRow:         4,
+	EmployeePhotoCell: "AF1",
+}
+
+// Week sheet sections, named as in log messages and validation errors.
+const (
+	sectionRegular  = "regular"
+	sectionNight    = "night"
+	sectionOvertime = "overtime"
+)
+
+// sheetSection is one block of seven day rows on a week sheet.
+type sheetSection struct {
+	Name      string
+	HeaderRow int
+	StartRow  int
+	TotalRow  int
+}
+
+// EndRow is the last day row of the section.
+func (s sheetSection) EndRow() int {
+	return s.StartRow + 6
+}
+
+// sections lists the sections the layout defines, in sheet order.
+func (l SheetLayout) sections() []sheetSection {
+	section := func(name string, headerRow, startRow, totalRow int) sheetSection {
+		if totalRow == 0 {
+			totalRow = startRow + 7
+		}
+		return sheetSection{name, headerRow, startRow, totalRow}
+	}
+	sections := []sheetSection{section(sectionRegular, l.RegularHeaderRow, l.RegularStartRow, l.RegularTotalRow)}
+	if l.NightShiftStartRow > 0 {
+		sections = append(sections, section(sectionNight, l.NightShiftHeaderRow, l.NightShiftStartRow, l.NightShiftTotalRow))
+	}
+	return append(sections, section(sectionOvertime, l.OvertimeHeaderRow, l.OvertimeStartRow, l.OvertimeTotalRow))
+}
+
+// sectionOf names the section an entry's hours are written to.
+func (l SheetLayout) sectionOf(e Entry) string {
+	switch {
+	case e.Overtime:
+		return sectionOvertime
+	case e.IsNightShift && l.NightShiftStartRow > 0:
+		return sectionNight
+	default:
+		return sectionRegular
+	}
+}
+
+// templateConfigFile is read from TemplateDir so a template can carry its own
+// layout.
+const templateConfigFile = "template_config.json"
+
+// Effective file-only settings, set by applyConfig.
+var (
+	templateDir = "."
+	sheetLayout = defaultSheetLayout
+)
+
+// templateFile resolves a template file name against TemplateDir.
+func templateFile(name string) string {
+	return filepath.Join(templateDir, name)
+}
+
+// joinWithin joins a relative name onto baseDir and fails if the result would
+// land outside it, as a name with ".." segments can.
+func joinWithin(baseDir, name string) (string, error) {
+	base := filepath.Clean(baseDir)
+	path := filepath.Clean(filepath.Join(base, name))
+	if !strings.HasPrefix(path, base+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%q escapes %s", name, baseDir)
+	}
+	return path, nil
+}
+
+// loadConfig reads CONFIG_FILE (if set) and merges the env on top. Merged plain
+// settings are written back to the environment so the existing os.Getenv
+// readers see file values too. It runs before logging is set up, so it returns
+// errors instead of logging them.
+func loadConfig() (Config, error) {
+	cfg := Config{SheetLayout: defaultSheetLayout}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("reading CONFIG_FILE: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("parsing CONFIG_FILE %s: %w", path, err)
+		}
+	}
+	dir := cfg.TemplateDir
+	if dir == "" {
+		dir = templateDir
+	}
+	layoutPath := filepath.Join(dir, templateConfigFile)
+	if data, err := os.ReadFile(layoutPath); err == nil {
+		if err := json.Unmarshal(data, &cfg.SheetLayout); err != nil {
+			return cfg, fmt.Errorf("parsing %s: %w", layoutPath, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return cfg, fmt.Errorf("reading %s: %w", layoutPath, err)
+	}
+	v := reflect.ValueOf(&cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		field := v.Field(i)
+		if envValue, ok := os.LookupEnv(key); ok {
+			field.SetString(envValue)
+		} else if field.String() != "" {
+			os.Setenv(key, field.String())
+		}
+	}
+	return cfg, nil
+}
+
+// applyConfig installs the file-only settings.
+func applyConfig(cfg Config) {
+	if cfg.TemplateDir != "" {
+		templateDir = cfg.TemplateDir
+	}
+	sheetLayout = cfg.SheetLayout
+	for id, tenant := range cfg.TenantConfigs {
+		if tenant == nil {
+			continue
+		}
+		tenant.ID = id
+		tenantConfigs.Store(id, tenant)
+		tenantsLoaded = true
+	}
+}
+
+// validateConfig checks the merged config and returns every problem found.
+func validateConfig(cfg Config) []error {
+	var errs []error
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, kind := t.Field(i).Tag.Get("env"), t.Field(i).Tag.Get("kind")
+		value := strings.TrimSpace(v.Field(i).String())
+		if key == "" || kind == "" || value == "" {
+			continue
+		}
+		var err error
+		switch kind {
+		case "int":
+			_, err = strconv.Atoi(value)
+		case "float":
+			_, err = strconv.ParseFloat(value, 64)
+		case "bool":
+			_, err = strconv.ParseBool(value)
+		case "date":
+			_, err = time.Parse(dateLayout, value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid %s %q", key, kind, value))
+		}
+	}
+	switch strings.ToLower(cfg.StorageBackend) {
+	case "", "local", "s3", "gcs":
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_BACKEND: must be local, s3 or gcs"))
+	}
+	if strings.EqualFold(cfg.StorageBackend, "s3") && cfg.S3Bucket == "" {
+		errs = append(errs, fmt.Errorf("S3_BUCKET: required when STORAGE_BACKEND=s3"))
+	}
+	switch strings.ToLower(cfg.SMTPAuthType) {
+	case "", "plain", "oauth2":
+	default:
+		errs = append(errs, fmt.Errorf("SMTP_AUTH_TYPE: must be plain or oauth2"))
+	}
+	for _, entry := range splitAndTrim(cfg.TrustedProxies) {
+		if _, err := parseProxyCIDR(entry); err != nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+		}
+	}
+	for _, entry := range splitAndTrim(cfg.AdminAllowedCIDR) {
+		if _, err := parseProxyCIDR(entry); err != nil {
+			errs = append(errs, fmt.Errorf("ADMIN_ALLOWED_CIDR: %w", err))
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.AuthType)) {
+	case "", authTypeAPIKey:
+	case authTypeJWT:
+		if cfg.JWTPublicKeyFile == "" {
+			errs = append(errs, fmt.Errorf("JWT_PUBLIC_KEY_FILE: required when AUTH_TYPE=jwt"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("AUTH_TYPE: must be %s or %s", authTypeAPIKey, authTypeJWT))
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.SMTPTLSMode)) {
+	case "", email.ModeStartTLS, email.ModeTLS, email.ModeNone:
+	default:
+		errs = append(errs, fmt.Errorf("SMTP_TLS_MODE: must be starttls, tls or none"))
+	}
+	if cfg.SMTPOAuth2TokenURL != "" {
+		if u, err := url.Parse(cfg.SMTPOAuth2TokenURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("SMTP_OAUTH2_TOKEN_URL: must be an absolute URL"))
+		}
+	}
+	if cfg.TemplateDir != "" {
+		if info, err := os.Stat(cfg.TemplateDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("template_dir: %s is not a directory", cfg.TemplateDir))
+		}
+	}
+	layout := cfg.SheetLayout
+	if layout.RegularHeaderRow < 1 || layout.RegularStartRow < 1 || layout.OvertimeHeaderRow < 1 || layout.OvertimeStartRow < 1 {
+		errs = append(errs, errors.New("sheet_layout: rows must be positive"))
+	}
+	if layout.NightShiftStartRow < 0 || layout.NightShiftStartRow > 0 && layout.NightShiftHeaderRow < 1 {
+		errs = append(errs, errors.New("sheet_layout: night_shift_start_row needs a positive night_shift_header_row"))
+	}
+	if layout.RegularTotalRow < 0 || layout.NightShiftTotalRow < 0 || layout.OvertimeTotalRow < 0 {
+		errs = append(errs, errors.New("sheet_layout: total rows must not be negative"))
+	}
+	sections := layout.sections()
+	for i, a := range sections {
+		for _, b := range sections[i+1:] {
+			if a.StartRow <= b.EndRow() && b.StartRow <= a.EndRow() {
+				errs = append(errs, fmt.Errorf("sheet_layout: %s rows %d-%d overlap %s rows %d-%d",
+					a.Name, a.StartRow, a.EndRow(), b.Name, b.StartRow, b.EndRow()))
+			}
+		}
+	}
+	if layout.Orientation != "portrait" && layout.Orientation != "landscape" {
+		errs = append(errs, fmt.Errorf("sheet_layout.orientation: must be portrait or landscape, got %q", layout.Orientation))
+	}
+	if layout.PaperSize < 1 {
+		errs = append(errs, errors.New("sheet_layout.paper_size: must be positive"))
+	}
+	if layout.PrintArea != "" {
+		if _, err := absoluteRange(layout.PrintArea); err != nil {
+			errs = append(errs, fmt.Errorf("sheet_layout.print_area: %w", err))
+		}
+	}
+	if layout.FreezeRow < 0 {
+		errs = append(errs, errors.New("sheet_layout.freeze_row: must not be negative"))
+	}
+	if layout.EmployeePhotoCell != "" {
+		if _, err := absoluteRange(layout.EmployeePhotoCell); err != nil {
+			errs = append(errs, fmt.Errorf("sheet_layout.employee_photo_cell: %w", err))
+		}
+	}
+	return errs
+}
+
+// logEffectiveConfig logs the merged config at DEBUG with secrets redacted.
+func logEffectiveConfig(cfg Config) {
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+	attrs := make([]any, 0, t.NumField()*2)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			name = strings.Split(field.Tag.Get("yaml"), ",")[0]
+		}
+		value := v.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" && v.Field(i).String() != "" {
+			value = "[redacted]"
+		}
+		if field.Name == "TenantConfigs" {
+			ids := make([]string, 0, len(cfg.TenantConfigs))
+			for id := range cfg.TenantConfigs {
+				ids = append(ids, id)
+			}
+			value = ids // tenant configs can carry SMTP passwords
+		}
+		attrs = append(attrs, name, value)
+	}
+	slog.Debug("effective config", attrs...)
+}
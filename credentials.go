@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// smtpSecrets holds the env SMTP password and OAuth2 client secret so
+// POST /admin/rotate-credentials can replace them without a restart.
+// Tenant SMTP settings are rotated by editing the tenant config instead.
+var smtpSecrets struct {
+	sync.RWMutex
+	pass               string
+	oauth2ClientSecret string
+}
+
+// adminMasterKey (ADMIN_MASTER_KEY) guards credential rotation, which is
+// disabled when it is empty.
+var adminMasterKey []byte
+
+func loadSMTPSecrets() {
+	smtpSecrets.Lock()
+	smtpSecrets.pass = os.Getenv("SMTP_PASS")
+	smtpSecrets.oauth2ClientSecret = os.Getenv("SMTP_OAUTH2_CLIENT_SECRET")
+	smtpSecrets.Unlock()
+	adminMasterKey = []byte(os.Getenv("ADMIN_MASTER_KEY"))
+}
+
+func smtpPassword() string {
+	smtpSecrets.RLock()
+	defer smtpSecrets.RUnlock()
+	return smtpSecrets.pass
+}
+
+func smtpOAuth2ClientSecret() string {
+	smtpSecrets.RLock()
+	defer smtpSecrets.RUnlock()
+	return smtpSecrets.oauth2ClientSecret
+}
+
+// RotateCredentialsRequest is the body of POST /admin/rotate-credentials.
+// Omitted fields keep their current value.
+type RotateCredentialsRequest struct {
+	SMTPPass               *string `json:"smtp_pass"`
+	SMTPOAuth2ClientSecret *string `json:"smtp_oauth2_client_secret"`
+	MicrosoftClientSecret  *string `json:"microsoft_client_secret"`
+}
+
+// rotateCredentialsHandler handles POST /admin/rotate-credentials. Besides
+// the usual bearer auth the caller must send ADMIN_MASTER_KEY in
+// X-Admin-Master-Key. New values are never logged.
+func rotateCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if len(adminMasterKey) == 0 {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: "Credential rotation is not enabled"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Master-Key")), adminMasterKey) != 1 {
+		slog.WarnContext(ctx, "credential rotation refused: bad master key")
+		respondError(w, r, http.StatusForbidden, APIError{Code: ErrForbidden, Message: "Missing or invalid X-Admin-Master-Key"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var req RotateCredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if req.MicrosoftClientSecret != nil {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "microsoft_client_secret: this build has no Microsoft Graph client"})
+		return
+	}
+	if (req.SMTPPass != nil && *req.SMTPPass == "") || (req.SMTPOAuth2ClientSecret != nil && *req.SMTPOAuth2ClientSecret == "") {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Credentials must not be empty"})
+		return
+	}
+	var rotated []string
+	smtpSecrets.Lock()
+	if req.SMTPPass != nil {
+		smtpSecrets.pass = *req.SMTPPass
+		rotated = append(rotated, "smtp")
+	}
+	if req.SMTPOAuth2ClientSecret != nil {
+		smtpSecrets.oauth2ClientSecret = *req.SMTPOAuth2ClientSecret
+		rotated = append(rotated, "smtp_oauth2")
+	}
+	smtpSecrets.Unlock()
+	if len(rotated) == 0 {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "No credentials to rotate"})
+		return
+	}
+	rotatedAt := time.Now().UTC()
+	slog.InfoContext(ctx, "credentials rotated for "+strings.Join(rotated, ", "), "rotated_at", rotatedAt.Format(time.RFC3339))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"rotated":    rotated,
+		"rotated_at": rotatedAt,
+	})
+}
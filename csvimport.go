@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvImportColumns are the columns a timesheet CSV must have, in any order.
+// Extra columns (e.g. labour_code) are allowed.
+var csvImportColumns = []string{"date", "job_code", "hours", "overtime", "night_shift", "description"}
+
+// importCSVHandler handles POST /api/import/csv: a multipart upload of a
+// desktop timesheet export ("file" field) converted into a TimecardRequest.
+// employee_name, pay_period_num, year and week_start_date can be sent as form
+// fields; job names come from the server's job list.
+func importCSVHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	if err := r.ParseMultipartForm(maxRequestBytes); err != nil {
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: file is required"})
+		return
+	}
+	defer file.Close()
+	entries, err := parseTimesheetCSV(file)
+	if err != nil {
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: ErrInvalidCSV, Message: fmt.Sprintf("Invalid CSV: %v", err)})
+		return
+	}
+	req := TimecardRequest{
+		EmployeeName:  strings.TrimSpace(r.FormValue("employee_name")),
+		WeekStartDate: r.FormValue("week_start_date"),
+		Entries:       entries,
+		Jobs:          []Job{},
+	}
+	if v := r.FormValue("pay_period_num"); v != "" {
+		if req.PayPeriodNum, err = strconv.Atoi(v); err != nil {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: pay_period_num must be a number"})
+			return
+		}
+	}
+	if v := r.FormValue("year"); v != "" {
+		if req.Year, err = strconv.Atoi(v); err != nil {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: year must be a number"})
+			return
+		}
+	} else if len(entries) > 0 {
+		first, _ := time.Parse(time.RFC3339, entries[0].Date)
+		req.Year = first.Year()
+	}
+	var known []Job
+	if tenant := tenantFromContext(ctx); tenant != nil {
+		known = tenant.Jobs
+	}
+	if len(known) == 0 {
+		known = defaultJobs()
+	}
+	jobNames := make(map[string]string, len(known))
+	for _, job := range known {
+		jobNames[job.JobNumber] = job.JobName
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.JobNumber] {
+			continue
+		}
+		seen[entry.JobNumber] = true
+		name, ok := jobNames[entry.JobNumber]
+		if !ok {
+			slog.WarnContext(ctx, "imported job is not in the job list", "job_number", entry.JobNumber)
+		}
+		req.Jobs = append(req.Jobs, Job{JobNumber: entry.JobNumber, JobName: name})
+	}
+	if errs := validateTimecardRequest(req); len(errs) > 0 {
+		respondValidationErrors(w, r, errs)
+		return
+	}
+	slog.InfoContext(ctx, "imported timesheet CSV", "employee_name", req.EmployeeName, "entries", len(entries), "jobs", len(req.Jobs))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// parseTimesheetCSV reads the header row and one entry per following row.
+// Dates may be YYYY-MM-DD or RFC 3339; overtime and night_shift accept
+// true/false, yes/no, 1/0 or blank. Entry has no description field, so that
+// column is read but not kept.
+func parseTimesheetCSV(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Excel's "CSV UTF-8" export starts with a byte order mark.
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range csvImportColumns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	labourCol, hasLabour := index["labour_code"]
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			return strings.TrimSpace(record[index[name]])
+		}
+		date, err := parseImportDate(field("date"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: date: %v", line, err)
+		}
+		hours, err := strconv.ParseFloat(field("hours"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: hours: %v", line, err)
+		}
+		overtime, err := parseImportBool(field("overtime"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: overtime: %v", line, err)
+		}
+		night, err := parseImportBool(field("night_shift"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: night_shift: %v", line, err)
+		}
+		entry := Entry{
+			Date:         date.Format(time.RFC3339),
+			JobNumber:    field("job_code"),
+			Hours:        hours,
+			Overtime:     overtime,
+			IsNightShift: night,
+		}
+		if hasLabour {
+			entry.LabourCode = strings.TrimSpace(record[labourCol])
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseImportBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "no", "n":
+		return false, nil
+	case "yes", "y":
+		return true, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testSMTPRequest is the body of POST /test/smtp.
+type testSMTPRequest struct {
+	To string `json:"to"`
+}
+
+// testSMTPHandler handles POST /test/smtp (admin only): it mails a one-cell
+// workbook to the given address through the normal sendEmail path so
+// operators can check SMTP end to end without a timecard payload.
+func testSMTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var req testSMTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if strings.TrimSpace(req.To) == "" {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: to is required"})
+		return
+	}
+	tenant := tenantFromContext(ctx)
+	host := os.Getenv("SMTP_HOST")
+	if tenant != nil && tenant.SMTP != nil {
+		host = tenant.SMTP.Host
+	}
+	respond := func(status int, errMsg string) {
+		body := map[string]any{
+			"status":           "ok",
+			"smtp_host":        host,
+			"message_accepted": errMsg == "",
+		}
+		if errMsg != "" {
+			body["status"] = "error"
+			body["error"] = errMsg
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	f := excelize.NewFile()
+	defer f.Close()
+	sentAt := time.Now().UTC().Format(time.RFC3339)
+	f.SetCellValue("Sheet1", "A1", "timecard-api SMTP test "+sentAt)
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		respond(http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = sendEmail(ctx, tenant, req.To, nil, "", "Timecard API SMTP test",
+		"This is a test message from the timecard API sent at "+sentAt+".\n", buf.Bytes(), "smtp-test")
+	if err != nil {
+		slog.WarnContext(ctx, "SMTP test failed", "smtp_host", host, "error", err)
+		status := http.StatusBadGateway
+		if err.Error() == "SMTP not configured" {
+			status = http.StatusServiceUnavailable
+		}
+		respond(status, err.Error())
+		return
+	}
+	slog.InfoContext(ctx, "SMTP test sent", "smtp_host", host, "to", req.To)
+	respond(http.StatusOK, "")
+}
+
+// templateTestRequest is the fixed timecard /test/template generates: one job,
+// 8 hours on each of Monday to Wednesday of the week starting 2024-01-08.
+func templateTestRequest() TimecardRequest {
+	return TimecardRequest{
+		EmployeeName:  "Template Test",
+		PayPeriodNum:  1,
+		Year:          2024,
+		WeekStartDate: "2024-01-08T00:00:00Z",
+		Jobs:          []Job{{JobNumber: "TEST", JobName: "Template smoke test"}},
+		Entries: []Entry{
+			{Date: "2024-01-08T00:00:00Z", JobNumber: "TEST", LabourCode: "227", Hours: 8},
+			{Date: "2024-01-09T00:00:00Z", JobNumber: "TEST", LabourCode: "227", Hours: 8},
+			{Date: "2024-01-10T00:00:00Z", JobNumber: "TEST", LabourCode: "227", Hours: 8},
+		},
+	}
+}
+
+// testTemplateHandler handles POST /test/template (admin only): it fills the
+// template with templateTestRequest and returns the workbook, so a template
+// update can be checked before real traffic hits it. Nothing is cached,
+// stored or audited.
+func testTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	tenant := tenantFromContext(ctx)
+	excelData, err := generateExcelFile(ctx, tenant, templateTestRequest())
+	if err != nil {
+		slog.ErrorContext(ctx, "template test failed", "template", tenant.timecardTemplatePath(), "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrGenerationFailed, Message: fmt.Sprintf("Error generating Excel file: %v", err)})
+		return
+	}
+	slog.InfoContext(ctx, "template test generated", "template", tenant.timecardTemplatePath(), "bytes", len(excelData))
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", attachmentDisposition("template_test.xlsx"))
+	w.Write(excelData)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// benchmarkTimecard is a two-week timecard with 14 entries spread over 8 jobs.
+func benchmarkTimecard() TimecardRequest {
+	req := TimecardRequest{
+		EmployeeName:  "Jane Doe",
+		PayPeriodNum:  3,
+		Year:          2024,
+		WeekStartDate: "2024-01-07T00:00:00Z",
+	}
+	for i := 0; i < 8; i++ {
+		req.Jobs = append(req.Jobs, Job{JobNumber: fmt.Sprintf("%d", 100+i), JobName: fmt.Sprintf("Job %d", i)})
+	}
+	start := time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 14; i++ {
+		req.Entries = append(req.Entries, Entry{
+			Date:       start.AddDate(0, 0, i).Format(time.RFC3339),
+			JobNumber:  req.Jobs[i%len(req.Jobs)].JobNumber,
+			LabourCode: "227",
+			Hours:      8,
+			Overtime:   i%5 == 4,
+		})
+	}
+	return req
+}
+
+func BenchmarkGenerateExcelFile(b *testing.B) {
+	req := benchmarkTimecard()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := generateExcelFile(ctx, nil, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildTimecardWorkbook(b *testing.B) {
+	req := benchmarkTimecard()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := buildTimecardWorkbook(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConvertExcelToPDF(b *testing.B) {
+	if testing.Short() {
+		b.Skip("PDF conversion is slow")
+	}
+	ctx := context.Background()
+	excelData, err := buildTimecardWorkbook(ctx, benchmarkTimecard())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := convertExcelToPDF(ctx, excelData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
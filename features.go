@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// FeatureFlags switch optional endpoints on and off. FEATURE_FLAGS is a JSON
+// object; keys it omits keep their defaults, so an unset variable leaves every
+// existing feature enabled.
+type FeatureFlags struct {
+	EnableGraphAPI bool `json:"enable_graph_api"`
+	EnablePDF      bool `json:"enable_pdf"`
+	EnableEmail    bool `json:"enable_email"`
+	EnableBatch    bool `json:"enable_batch"`
+	EnableAuditLog bool `json:"enable_audit_log"`
+}
+
+// features holds the active flags. EnableGraphAPI defaults to false because
+// this build has no Graph integration; the flag is exposed for clients only.
+var features = FeatureFlags{
+	EnablePDF:      true,
+	EnableEmail:    true,
+	EnableBatch:    true,
+	EnableAuditLog: true,
+}
+
+func loadFeatureFlags() {
+	raw := os.Getenv("FEATURE_FLAGS")
+	if raw == "" {
+		return
+	}
+	flags := features
+	if err := json.Unmarshal([]byte(raw), &flags); err != nil {
+		slog.Error("invalid FEATURE_FLAGS, using defaults", "error", err)
+		return
+	}
+	features = flags
+	slog.Info("feature flags loaded", "flags", features)
+}
+
+// requireFeature answers 501 when a gated feature is off.
+func requireFeature(enabled *bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !*enabled {
+			respondError(w, r, http.StatusNotImplemented, APIError{Code: ErrFeatureDisabled, Message: "This feature is disabled on this server"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// featuresHandler handles GET /api/features.
+func featuresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(features)
+}
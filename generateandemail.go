@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"timecard-api/internal/email"
+)
+
+// GenerateAndEmailRequest is an EmailTimecardRequest that may also ask for a
+// PDF copy alongside the workbook.
+type GenerateAndEmailRequest struct {
+	EmailTimecardRequest
+	IncludePDF bool `json:"include_pdf,omitempty"`
+}
+
+// GenerateAndEmailResponse reports which steps of generate-and-email ran.
+type GenerateAndEmailResponse struct {
+	Status         string   `json:"status"`
+	EmailID        string   `json:"email_id"`
+	ExcelGenerated bool     `json:"excel_generated"`
+	PDFGenerated   bool     `json:"pdf_generated"`
+	EmailSent      bool     `json:"email_sent"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// generateAndEmailTimecardHandler handles POST /api/generate-and-email-timecard:
+// it builds the workbook (and optionally a PDF) and emails them in one request,
+// all under EMAIL_TIMEOUT_SECONDS (default 180). A failed PDF is reported as a
+// warning; the workbook is still sent.
+func generateAndEmailTimecardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var req GenerateAndEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.WarnContext(r.Context(), "error decoding request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	errs := validateTimecardRequest(req.TimecardRequest)
+	if len(splitAndTrim(req.To)) == 0 {
+		errs = append(errs, ValidationError{Field: "to", Code: ValidationRequired, Message: "to is required"})
+	}
+	if len(errs) > 0 {
+		respondValidationErrors(w, r, errs)
+		return
+	}
+	if !checkEmployeePhotoURL(w, r, req.TimecardRequest) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), emailTimeout())
+	defer cancel()
+	record := newEmailRecord(ctx, req.To, req.Subject)
+	start := time.Now()
+	slog.InfoContext(ctx, "generating and emailing timecard",
+		"employee_name", req.EmployeeName,
+		"pay_period", req.PayPeriodNum,
+		"to", req.To,
+		"include_pdf", req.IncludePDF,
+		"email_id", record.ID,
+	)
+	resp, code, err := generateAndEmail(ctx, r, req, record)
+	if err != nil {
+		respondGenerateAndEmailError(ctx, w, r, code, err.Error())
+		return
+	}
+	slog.InfoContext(ctx, "generated and emailed timecard",
+		"employee_name", req.EmployeeName,
+		"email_id", record.ID,
+		"pdf_generated", resp.PDFGenerated,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// generateAndEmail builds req's workbook, optionally a PDF, and emails them,
+// updating record as it goes. On failure it returns the API error code for the
+// failed step and an error whose text is the client-facing message.
+func generateAndEmail(ctx context.Context, r *http.Request, req GenerateAndEmailRequest, record *EmailRecord) (GenerateAndEmailResponse, string, error) {
+	resp := GenerateAndEmailResponse{Status: "ok", EmailID: record.ID}
+	auditID := auditStart(r, AuditActionGenerateAndEmail, req.TimecardRequest)
+	excelData, err := buildTimecardWorkbook(ctx, req.TimecardRequest)
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating Excel", "employee_name", req.EmployeeName, "error", err)
+		record.markFailed(err)
+		auditFinish(ctx, auditID, err)
+		return resp, ErrGenerationFailed, fmt.Errorf("Error generating timecard: %v", err)
+	}
+	resp.ExcelGenerated = true
+	attachments := []email.Attachment{{
+		FileName:    timecardAttachmentName(req.EmployeeName, "xlsx"),
+		ContentType: xlsxContentType,
+		Data:        excelData,
+	}}
+	if req.IncludePDF {
+		if pdfData, err := generatePDFAttachment(ctx, excelData); err != nil {
+			slog.WarnContext(ctx, "PDF not attached", "employee_name", req.EmployeeName, "error", err)
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("PDF not attached: %v", err))
+		} else {
+			resp.PDFGenerated = true
+			attachments = append(attachments, email.Attachment{
+				FileName:    timecardAttachmentName(req.EmployeeName, "pdf"),
+				ContentType: pdfContentType,
+				Data:        pdfData,
+			})
+		}
+	}
+	err = sendEmailWithAttachments(ctx, tenantFromContext(ctx), req.To, req.CC, req.ReplyTo, req.Subject, req.Body, attachments)
+	recordEmail(err)
+	auditFinish(ctx, auditID, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending email", "email_id", record.ID, "error", err)
+		record.markFailed(err)
+		return resp, ErrEmailFailed, fmt.Errorf("Error sending email: %v", err)
+	}
+	record.markSent()
+	resp.EmailSent = true
+	return resp, "", nil
+}
+
+// generatePDFAttachment converts the workbook to PDF, honouring
+// features.EnablePDF.
+func generatePDFAttachment(ctx context.Context, excelData []byte) ([]byte, error) {
+	if !features.EnablePDF {
+		return nil, errors.New("PDF output is disabled on this server")
+	}
+	return convertExcelToPDF(ctx, excelData)
+}
+
+// respondGenerateAndEmailError answers 504 when the request ran out of time and
+// 500 with code otherwise.
+func respondGenerateAndEmailError(ctx context.Context, w http.ResponseWriter, r *http.Request, code, message string) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		respondError(w, r, http.StatusGatewayTimeout, APIError{Code: ErrTimeout, Message: "Timed out generating and emailing the timecard"})
+		return
+	}
+	respondError(w, r, http.StatusInternalServerError, APIError{Code: code, Message: message})
+}
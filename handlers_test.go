@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// oneWeekRequest is a valid single-week timecard: 8 regular hours and 2
+// overtime hours on job 234.
+const oneWeekRequest = `{
+	"employee_name": "Jane Doe",
+	"pay_period_num": 3,
+	"year": 2024,
+	"week_start_date": "2024-01-07T00:00:00Z",
+	"jobs": [{"job_number": "234", "job_name": "Plant"}],
+	"entries": [
+		{"date": "2024-01-08T00:00:00Z", "job_number": "234", "labour_code": "227", "hours": 8},
+		{"date": "2024-01-09T00:00:00Z", "job_number": "234", "labour_code": "227", "hours": 2, "overtime": true}
+	]
+}`
+
+func TestGenerateTimecardHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		maxBytes int64
+		status   int
+		code     string // APIError code for error responses
+	}{
+		{name: "valid one-week request", method: http.MethodPost, body: oneWeekRequest, status: http.StatusOK},
+		{name: "no entries", method: http.MethodPost, body: `{"employee_name": "Jane Doe", "pay_period_num": 3, "year": 2024}`, status: http.StatusUnprocessableEntity},
+		{name: "malformed JSON", method: http.MethodPost, body: `{"employee_name": `, status: http.StatusBadRequest, code: ErrInvalidRequest},
+		{name: "GET", method: http.MethodGet, status: http.StatusMethodNotAllowed, code: ErrMethodNotAllowed},
+		{name: "body over the limit", method: http.MethodPost, body: oneWeekRequest, maxBytes: 64, status: http.StatusRequestEntityTooLarge, code: ErrRequestTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.maxBytes > 0 {
+				defer func(old int64) { maxRequestBytes = old }(maxRequestBytes)
+				maxRequestBytes = tt.maxBytes
+			}
+			req := httptest.NewRequest(tt.method, "/api/generate-timecard", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			generateTimecardHandler(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.code != "" {
+				var apiErr APIError
+				if err := json.Unmarshal(rec.Body.Bytes(), &apiErr); err != nil {
+					t.Fatalf("error body: %v", err)
+				}
+				if apiErr.Code != tt.code {
+					t.Errorf("code = %q, want %q", apiErr.Code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateTimecardHandlerWorkbook(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/generate-timecard", strings.NewReader(oneWeekRequest))
+	rec := httptest.NewRecorder()
+	generateTimecardHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != xlsxContentType {
+		t.Errorf("Content-Type = %q, want %q", got, xlsxContentType)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("response is not a workbook: %v", err)
+	}
+	f.Close()
+
+	raw, err := base64.StdEncoding.DecodeString(rec.Header().Get("X-Timecard-Hours-Summary"))
+	if err != nil {
+		t.Fatalf("X-Timecard-Hours-Summary: %v", err)
+	}
+	var summary HoursSummary
+	if err := json.Unmarshal(raw, &summary); err != nil {
+		t.Fatalf("X-Timecard-Hours-Summary: %v", err)
+	}
+	if summary.Regular != 8 || summary.Overtime != 2 || summary.Total != 10 {
+		t.Errorf("summary = %+v, want 8 regular + 2 overtime", summary.HoursBreakdown)
+	}
+}
+
+func TestValidateTimecardPreviewHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/validate-timecard", strings.NewReader(oneWeekRequest))
+	rec := httptest.NewRecorder()
+	validateTimecardPreviewHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+	}
+	var preview TimecardPreview
+	if err := json.Unmarshal(rec.Body.Bytes(), &preview); err != nil {
+		t.Fatal(err)
+	}
+	if !preview.Valid {
+		t.Fatalf("preview not valid: %+v", preview.Errors)
+	}
+	if len(preview.ComputedWeeks) != 1 || len(preview.ComputedWeeks[0].Jobs) != 1 {
+		t.Fatalf("computed weeks = %+v, want one week with one job", preview.ComputedWeeks)
+	}
+	if job := preview.ComputedWeeks[0].Jobs[0]; job.RegularHours != 8 || job.OvertimeHours != 2 {
+		t.Errorf("job hours = %+v, want 8 regular + 2 overtime", job)
+	}
+}
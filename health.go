@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// startTime is used to report uptime from /health.
+var startTime = time.Now()
+
+// Readiness flags. serverReady is set at the end of main() once every route is
+// registered and the listener is starting; templateLoaded once the startup
+// template check passes; smtpDialed after the first successful SMTP dial.
+var (
+	serverReady    atomic.Bool
+	templateLoaded atomic.Bool
+	smtpDialed     atomic.Bool
+)
+
+const smtpDialTimeout = 3 * time.Second
+
+// HealthResponse is the body of GET /health.
+type HealthResponse struct {
+	Status        string            `json:"status"`
+	Dependencies  map[string]string `json:"dependencies"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+}
+
+// healthHandler reports the state of the server's dependencies. The template is
+// critical: without it nothing can be generated, so a missing template returns
+// 503. An unreachable SMTP server only affects email, so it marks the service
+// degraded but still returns 200.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	deps := map[string]string{
+		"smtp":     checkSMTP(),
+		"graph":    "not_configured", // no Microsoft Graph client in this build
+		"template": checkTemplate(),
+	}
+	resp := HealthResponse{
+		Status:        "ok",
+		Dependencies:  deps,
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	}
+	code := http.StatusOK
+	if deps["smtp"] != "ok" || deps["template"] != "ok" {
+		resp.Status = "degraded"
+	}
+	if deps["template"] != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	if resp.Status != "ok" {
+		slog.WarnContext(ctx, "health check degraded", "dependencies", deps)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkSMTP dials SMTP_HOST:SMTP_PORT without speaking SMTP.
+func checkSMTP() string {
+	host, port := os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT")
+	if host == "" || port == "" {
+		return "error"
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), smtpDialTimeout)
+	if err != nil {
+		slog.Debug("health: smtp dial failed", "host", host, "port", port, "error", err)
+		return "error"
+	}
+	conn.Close()
+	smtpDialed.Store(true)
+	return "ok"
+}
+
+func checkTemplate() string {
+	if _, err := readTemplate(templateFile("template.xlsx")); err != nil {
+		return "missing"
+	}
+	return "ok"
+}
+
+// livenessHandler answers as long as the process can serve HTTP. It deliberately
+// checks nothing else so a slow dependency never gets the pod restarted.
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "alive"})
+}
+
+// readinessHandler returns 503 until the server is initialised, the template has
+// loaded and SMTP has been reached at least once. The SMTP dial is retried on
+// each probe until it succeeds, then never again. When email is disabled by
+// feature flag or SMTP_HOST/SMTP_PORT are unset there is nothing to reach, so
+// the SMTP check is skipped and left out of the response.
+func readinessHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]bool{
+		"server":   serverReady.Load(),
+		"template": templateLoaded.Load(),
+	}
+	if features.EnableEmail && os.Getenv("SMTP_HOST") != "" && os.Getenv("SMTP_PORT") != "" {
+		if !smtpDialed.Load() {
+			checkSMTP()
+		}
+		checks["smtp"] = smtpDialed.Load()
+	}
+	status, code := "ready", http.StatusOK
+	for _, ok := range checks {
+		if !ok {
+			status, code = "not_ready", http.StatusServiceUnavailable
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
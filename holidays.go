@@ -0,0 +1,241 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// holidaysJSON is the bundled statutory holiday calendar. Holidays are stored
+// as rules rather than dates so the file covers every year; observed-day
+// shifts for holidays that fall on a weekend are not modelled.
+//
+//go:embed holidays.json
+var holidaysJSON []byte
+
+// holidayRule describes how to find a holiday's date in a given year:
+//   - fixed: month/day
+//   - nth_weekday: the nth weekday of month (n = -1 for the last)
+//   - weekday_before: the last weekday strictly before month/day
+//   - easter: offset days from Easter Sunday
+type holidayRule struct {
+	Name     string `json:"name"`
+	Rule     string `json:"rule"`
+	Month    int    `json:"month,omitempty"`
+	Day      int    `json:"day,omitempty"`
+	Weekday  string `json:"weekday,omitempty"`
+	N        int    `json:"n,omitempty"`
+	Offset   int    `json:"offset,omitempty"`
+	FromYear int    `json:"from_year,omitempty"`
+}
+
+type holidayJurisdiction struct {
+	Name     string        `json:"name"`
+	Holidays []holidayRule `json:"holidays"`
+}
+
+// holidayCalendar maps a jurisdiction code ("CA-ON", "US") to its holidays.
+var holidayCalendar map[string]holidayJurisdiction
+
+// Holiday is one statutory holiday in a year.
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// HolidaysRequest is the body of POST /api/holidays.
+type HolidaysRequest struct {
+	Year         int    `json:"year"`
+	Jurisdiction string `json:"jurisdiction"`
+}
+
+var weekdaysByName = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+// loadHolidays parses the bundled calendar. A rule it can't evaluate is a
+// build mistake, so it is logged and dropped rather than served.
+func loadHolidays() {
+	var file struct {
+		Jurisdictions map[string]holidayJurisdiction `json:"jurisdictions"`
+	}
+	if err := json.Unmarshal(holidaysJSON, &file); err != nil {
+		slog.Error("could not parse bundled holidays.json", "error", err)
+		return
+	}
+	for code, jurisdiction := range file.Jurisdictions {
+		valid := jurisdiction.Holidays[:0]
+		for _, rule := range jurisdiction.Holidays {
+			if _, err := rule.date(2000); err != nil {
+				slog.Error("ignoring invalid holiday rule", "jurisdiction", code, "holiday", rule.Name, "error", err)
+				continue
+			}
+			valid = append(valid, rule)
+		}
+		jurisdiction.Holidays = valid
+		file.Jurisdictions[code] = jurisdiction
+	}
+	holidayCalendar = file.Jurisdictions
+	slog.Info("holiday calendar loaded", "jurisdictions", len(holidayCalendar))
+}
+
+func (h holidayRule) date(year int) (time.Time, error) {
+	switch h.Rule {
+	case "fixed":
+		return time.Date(year, time.Month(h.Month), h.Day, 0, 0, 0, 0, time.UTC), nil
+	case "nth_weekday":
+		weekday, ok := weekdaysByName[h.Weekday]
+		if !ok || h.N == 0 {
+			return time.Time{}, fmt.Errorf("nth_weekday needs a weekday and n")
+		}
+		if h.N < 0 {
+			last := time.Date(year, time.Month(h.Month)+1, 0, 0, 0, 0, 0, time.UTC)
+			return last.AddDate(0, 0, -((int(last.Weekday()) - int(weekday) + 7) % 7)), nil
+		}
+		first := time.Date(year, time.Month(h.Month), 1, 0, 0, 0, 0, time.UTC)
+		return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(h.N-1)), nil
+	case "weekday_before":
+		weekday, ok := weekdaysByName[h.Weekday]
+		if !ok {
+			return time.Time{}, fmt.Errorf("weekday_before needs a weekday")
+		}
+		before := time.Date(year, time.Month(h.Month), h.Day-1, 0, 0, 0, 0, time.UTC)
+		return before.AddDate(0, 0, -((int(before.Weekday()) - int(weekday) + 7) % 7)), nil
+	case "easter":
+		return easterSunday(year).AddDate(0, 0, h.Offset), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown rule %q", h.Rule)
+}
+
+// easterSunday returns the date of Western Easter using the anonymous
+// Gregorian algorithm.
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// holidaysFor lists a jurisdiction's holidays in year, in date order. ok is
+// false for an unknown jurisdiction.
+func holidaysFor(jurisdiction string, year int) ([]Holiday, bool) {
+	calendar, ok := holidayCalendar[strings.ToUpper(strings.TrimSpace(jurisdiction))]
+	if !ok {
+		return nil, false
+	}
+	holidays := []Holiday{}
+	for _, rule := range calendar.Holidays {
+		if rule.FromYear != 0 && year < rule.FromYear {
+			continue
+		}
+		date, err := rule.date(year)
+		if err != nil {
+			continue
+		}
+		holidays = append(holidays, Holiday{Date: date.Format(dateLayout), Name: rule.Name})
+	}
+	sort.SliceStable(holidays, func(i, j int) bool { return holidays[i].Date < holidays[j].Date })
+	return holidays, true
+}
+
+// holidayJurisdictions lists the known jurisdiction codes, sorted.
+func holidayJurisdictions() []string {
+	codes := make([]string, 0, len(holidayCalendar))
+	for code := range holidayCalendar {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// holidayWarnings flags regular day-shift hours booked on a statutory holiday
+// in req.Jurisdiction. They don't block generation.
+func holidayWarnings(req TimecardRequest) []string {
+	if strings.TrimSpace(req.Jurisdiction) == "" {
+		return nil
+	}
+	if _, ok := holidayCalendar[strings.ToUpper(strings.TrimSpace(req.Jurisdiction))]; !ok {
+		return []string{fmt.Sprintf("jurisdiction %q has no holiday calendar; holidays were not checked", req.Jurisdiction)}
+	}
+	byYear := map[int]map[string]string{}
+	var warnings []string
+	warned := map[string]bool{}
+	for _, week := range timecardWeeks(req) {
+		for _, entry := range week.Entries {
+			if entry.Overtime || entry.IsNightShift || entry.Hours <= 0 {
+				continue
+			}
+			date, err := time.Parse(time.RFC3339, entry.Date)
+			if err != nil {
+				continue
+			}
+			names, ok := byYear[date.Year()]
+			if !ok {
+				names = map[string]string{}
+				holidays, _ := holidaysFor(req.Jurisdiction, date.Year())
+				for _, holiday := range holidays {
+					names[holiday.Date] = holiday.Name
+				}
+				byYear[date.Year()] = names
+			}
+			day := date.Format(dateLayout)
+			if name, ok := names[day]; ok && !warned[day] {
+				warned[day] = true
+				warnings = append(warnings, fmt.Sprintf("regular hours are booked on %s (%s), a statutory holiday in %s", day, name, strings.ToUpper(req.Jurisdiction)))
+			}
+		}
+	}
+	return warnings
+}
+
+// holidaysHandler handles POST /api/holidays: the statutory holidays of one
+// jurisdiction in one year.
+func holidaysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var req HolidaysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	var errs []ValidationError
+	if req.Year < minTimecardYear || req.Year > maxTimecardYear {
+		errs = append(errs, ValidationError{Field: "year", Code: ValidationInvalidYear, Message: fmt.Sprintf("year must be between %d and %d", minTimecardYear, maxTimecardYear)})
+	}
+	if strings.TrimSpace(req.Jurisdiction) == "" {
+		errs = append(errs, ValidationError{Field: "jurisdiction", Code: ValidationRequired, Message: "jurisdiction is required"})
+	}
+	if len(errs) > 0 {
+		respondValidationErrors(w, r, errs)
+		return
+	}
+	holidays, ok := holidaysFor(req.Jurisdiction, req.Year)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, APIError{
+			Code:    ErrNotFound,
+			Message: fmt.Sprintf("No holiday calendar for jurisdiction %q", req.Jurisdiction),
+			Details: []string{"known jurisdictions: " + strings.Join(holidayJurisdictions(), ", ")},
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holidays)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HoursBreakdown totals hours by kind. An overtime entry counts as overtime
+// even when it is also a night shift, as it does on the sheet.
+type HoursBreakdown struct {
+	Regular  float64 `json:"regular"`
+	Night    float64 `json:"night"`
+	Overtime float64 `json:"overtime"`
+	Total    float64 `json:"total"`
+}
+
+func (b *HoursBreakdown) add(entry Entry) {
+	switch {
+	case entry.Overtime:
+		b.Overtime += entry.Hours
+	case entry.IsNightShift:
+		b.Night += entry.Hours
+	default:
+		b.Regular += entry.Hours
+	}
+	b.Total += entry.Hours
+}
+
+// JobHours is the HoursBreakdown for one job across the whole timecard.
+type JobHours struct {
+	JobNumber string `json:"job_number"`
+	HoursBreakdown
+}
+
+// HoursSummary is the X-Timecard-Hours-Summary payload: the timecard's totals
+// and the rounding applied to reach them.
+type HoursSummary struct {
+	HoursBreakdown
+	Rounding RoundingConfig `json:"rounding"`
+}
+
+// summarizeHours totals the hours that land on the sheet: entries dated
+// outside their week are skipped, and each day's hours per column are rounded
+// with req.Rounding, as they are when the workbook is built. Jobs are listed
+// in the order they first appear.
+func summarizeHours(req TimecardRequest) (HoursBreakdown, []JobHours) {
+	type cell struct {
+		date     string
+		column   string
+		overtime bool
+	}
+	var total HoursBreakdown
+	jobs := []JobHours{}
+	index := map[string]int{}
+	for _, week := range timecardWeeks(req) {
+		weekStart, err := time.Parse(time.RFC3339, week.WeekStartDate)
+		if err != nil {
+			continue
+		}
+		weekEnd := weekStart.AddDate(0, 0, 7)
+		var cells []cell
+		sums := map[cell]Entry{}
+		for _, entry := range week.Entries {
+			date, err := time.Parse(time.RFC3339, entry.Date)
+			if err != nil || date.Before(weekStart) || !date.Before(weekEnd) {
+				continue
+			}
+			key := cell{date.Format(dateLayout), columnKey(entry), entry.Overtime}
+			sum, ok := sums[key]
+			if !ok {
+				sum = entry
+				sum.Hours = 0
+				cells = append(cells, key)
+			}
+			sum.Hours += entry.Hours
+			sums[key] = sum
+		}
+		for _, key := range cells {
+			entry := sums[key]
+			if entry.Hours <= 0 {
+				continue
+			}
+			entry.Hours = roundHours(entry.Hours, req.Rounding)
+			jobNumber := strings.TrimSpace(entry.JobNumber)
+			i, ok := index[jobNumber]
+			if !ok {
+				i = len(jobs)
+				index[jobNumber] = i
+				jobs = append(jobs, JobHours{JobNumber: jobNumber})
+			}
+			jobs[i].add(entry)
+			total.add(entry)
+		}
+	}
+	return total, jobs
+}
+
+// setHoursSummaryHeaders adds X-Timecard-Hours-Summary (a HoursSummary) and X-Timecard-Job-Hours (a JobHours list), each as
+// base64-encoded JSON, so clients can show totals without opening the workbook.
+func setHoursSummaryHeaders(w http.ResponseWriter, req TimecardRequest) {
+	total, jobs := summarizeHours(req)
+	summary := HoursSummary{HoursBreakdown: total, Rounding: req.Rounding}
+	if summary.Rounding.Mode == "" {
+		summary.Rounding.Mode = RoundingNone
+	}
+	if summary.Rounding.Mode != RoundingNone && summary.Rounding.Direction == "" {
+		summary.Rounding.Direction = RoundingNearest
+	}
+	if data, err := json.Marshal(summary); err == nil {
+		w.Header().Set("X-Timecard-Hours-Summary", base64.StdEncoding.EncodeToString(data))
+	}
+	if data, err := json.Marshal(jobs); err == nil {
+		w.Header().Set("X-Timecard-Job-Hours", base64.StdEncoding.EncodeToString(data))
+	}
+}
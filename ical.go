@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// icalTimestamp is the RFC 5545 date-time form. Entry times are written as
+// floating local times since entries carry a date but no time zone.
+const icalTimestamp = "20060102T150405"
+
+// jobStartHour is when each entry's event starts (JOB_START_HOUR, default 9).
+func jobStartHour() int {
+	hour := getEnvInt("JOB_START_HOUR", 9)
+	if hour < 0 || hour > 23 {
+		return 9
+	}
+	return hour
+}
+
+// timecardICalHandler handles GET /api/timecards/{id}/ical: one VEVENT per
+// entry of the stored timecard request.
+func timecardICalHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, ok := timecardIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	var stored []byte
+	var createdAt time.Time
+	err := timecardDB.QueryRowContext(ctx,
+		`SELECT request, created_at FROM timecards WHERE id = $1 AND tenant_id = $2`, id, tenantIDFromContext(ctx),
+	).Scan(&stored, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "Timecard not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "timecard db: lookup failed", "timecard_id", id, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading timecard"})
+		return
+	}
+	if stored == nil {
+		// Rows recorded before requests were stored.
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNoEntries, Message: "No entries stored for this timecard"})
+		return
+	}
+	var req TimecardRequest
+	if err := json.Unmarshal(stored, &req); err != nil {
+		slog.ErrorContext(ctx, "timecard db: stored request is invalid", "timecard_id", id, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading timecard"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="timecard.ics"`)
+	w.Write([]byte(buildTimecardICal(id, req, createdAt)))
+}
+
+// buildTimecardICal renders req's entries as an iCalendar document.
+func buildTimecardICal(id string, req TimecardRequest, stamp time.Time) string {
+	jobNames := make(map[string]string, len(req.Jobs))
+	for _, job := range req.Jobs {
+		jobNames[job.JobNumber] = job.JobName
+	}
+	entries := req.Entries
+	if len(entries) == 0 {
+		for _, week := range req.Weeks {
+			entries = append(entries, week.Entries...)
+		}
+	}
+	startHour := jobStartHour()
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldICalLine(s))
+		b.WriteString("\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//timecard-api//Timecard Export//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + escapeICalText(fmt.Sprintf("%s – Pay Period %d, %d", req.EmployeeName, req.PayPeriodNum, req.Year)))
+	for i, entry := range entries {
+		date, err := time.Parse(time.RFC3339, entry.Date)
+		if err != nil {
+			continue
+		}
+		start := time.Date(date.Year(), date.Month(), date.Day(), startHour, 0, 0, 0, time.UTC)
+		end := start.Add(time.Duration(entry.Hours * float64(time.Hour)))
+		summary := entry.JobNumber
+		if name := jobNames[entry.JobNumber]; name != "" {
+			summary = name + " (" + entry.JobNumber + ")"
+		}
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:%s-%d@timecard-api", id, i))
+		line("DTSTAMP:" + stamp.UTC().Format(icalTimestamp) + "Z")
+		line("DTSTART:" + start.Format(icalTimestamp))
+		line("DTEND:" + end.Format(icalTimestamp))
+		line("SUMMARY:" + escapeICalText(summary))
+		if entry.LabourCode != "" {
+			line("DESCRIPTION:" + escapeICalText("Labour code: "+entry.LabourCode))
+		}
+		var categories []string
+		if entry.Overtime {
+			categories = append(categories, "OVERTIME")
+		}
+		if entry.IsNightShift {
+			categories = append(categories, "NIGHT-SHIFT")
+		}
+		if len(categories) > 0 {
+			line("CATEGORIES:" + strings.Join(categories, ","))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// escapeICalText escapes a TEXT value (RFC 5545 section 3.3.11).
+func escapeICalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICalLine splits lines longer than 75 octets, continuing with a space,
+// without breaking a UTF-8 sequence.
+func foldICalLine(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(s)
+	return b.String()
+}
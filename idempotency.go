@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyTTL is how long a response is kept for replay.
+const idempotencyTTL = 5 * time.Minute
+
+// idempotencyMaxInFlight is how long an unfinished entry may block its key
+// before the sweeper drops it. It is well past the generate and email
+// timeouts, so only a request that never completed is affected.
+const idempotencyMaxInFlight = 15 * time.Minute
+
+// idempotentResponse is a finished (or in-flight, done == false) response for
+// one Idempotency-Key.
+type idempotentResponse struct {
+	mu        sync.Mutex
+	done      bool
+	status    int
+	header    http.Header
+	body      []byte
+	startedAt time.Time
+	expiresAt time.Time
+}
+
+var idempotencyKeys sync.Map // scoped key -> *idempotentResponse
+
+// initIdempotency starts the sweeper that drops expired Idempotency-Key entries.
+func initIdempotency() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			evictIdempotencyKeys(time.Now())
+		}
+	}()
+}
+
+func evictIdempotencyKeys(now time.Time) {
+	idempotencyKeys.Range(func(key, value any) bool {
+		resp := value.(*idempotentResponse)
+		resp.mu.Lock()
+		expired := resp.done && now.After(resp.expiresAt)
+		stale := !resp.done && now.Sub(resp.startedAt) > idempotencyMaxInFlight
+		resp.mu.Unlock()
+		if expired || stale {
+			idempotencyKeys.CompareAndDelete(key, resp)
+		}
+		return true
+	})
+}
+
+// idempotencyMiddleware replays the stored response when a POST repeats an
+// Idempotency-Key seen in the last five minutes, so a client retrying after a
+// timeout doesn't send the same email twice. Keys are scoped to the caller's
+// token, tenant and path. A retry that arrives while the first request is
+// still running gets 409. 5xx responses are not stored, so those can be
+// retried.
+func idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		tenantID := ""
+		if tenant := tenantFromContext(ctx); tenant != nil {
+			tenantID = tenant.ID
+		}
+		sum := sha256.Sum256([]byte(r.Header.Get("Authorization") + "\x00" + tenantID + "\x00" + r.URL.Path + "\x00" + key))
+		scoped := hex.EncodeToString(sum[:])
+		entry := &idempotentResponse{startedAt: time.Now()}
+		if existing, loaded := idempotencyKeys.LoadOrStore(scoped, entry); loaded {
+			prev := existing.(*idempotentResponse)
+			prev.mu.Lock()
+			done, status, header, body := prev.done, prev.status, prev.header, prev.body
+			prev.mu.Unlock()
+			if !done {
+				respondError(w, r, http.StatusConflict, APIError{Code: ErrIdempotencyInProgress, Message: "A request with this Idempotency-Key is still in progress"})
+				return
+			}
+			slog.InfoContext(ctx, "replaying idempotent response", "path", r.URL.Path, "status", status)
+			for name, values := range header {
+				if name == "X-Request-Id" {
+					continue
+				}
+				w.Header()[name] = values
+			}
+			w.Header().Set("X-Idempotent-Replayed", "true")
+			w.WriteHeader(status)
+			w.Write(body)
+			return
+		}
+		// Release the key unless a response was stored, so a panic or a 5xx
+		// leaves it free for the client's retry.
+		defer func() {
+			entry.mu.Lock()
+			done := entry.done
+			entry.mu.Unlock()
+			if !done {
+				idempotencyKeys.CompareAndDelete(scoped, entry)
+			}
+		}()
+		rec := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status >= 500 {
+			return
+		}
+		entry.mu.Lock()
+		entry.done = true
+		entry.status = rec.status
+		entry.header = w.Header().Clone()
+		entry.body = rec.body.Bytes()
+		entry.expiresAt = time.Now().Add(idempotencyTTL)
+		entry.mu.Unlock()
+	})
+}
+
+// recordingResponseWriter passes a response through while keeping a copy.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
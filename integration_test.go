@@ -0,0 +1,244 @@
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	"timecard-api/internal/email"
+)
+
+// smtpStub is a plaintext SMTP server that accepts AUTH PLAIN and keeps the
+// DATA of every message it is sent.
+type smtpStub struct {
+	ln       net.Listener
+	messages chan string
+}
+
+func startSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &smtpStub{ln: ln, messages: make(chan string, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-stub")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			tp.PrintfLine("235 OK")
+		case "MAIL", "RCPT":
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.messages <- string(data)
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// messageAttachments returns the decoded attachments of a multipart message
+// by file name.
+func messageAttachments(t *testing.T, raw string) map[string][]byte {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type: %v", err)
+	}
+	attachments := map[string][]byte{}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return attachments
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		encoded, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+		if err != nil {
+			t.Fatalf("%s is not base64: %v", part.FileName(), err)
+		}
+		attachments[part.FileName()] = data
+	}
+}
+
+func TestGenerateAndEmailTimecard(t *testing.T) {
+	stub := startSMTPStub(t)
+	host, port, _ := net.SplitHostPort(stub.ln.Addr().String())
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PORT", port)
+	t.Setenv("SMTP_USER", "payroll@example.com")
+	t.Setenv("SMTP_PASS", "secret")
+	t.Setenv("SMTP_TLS_MODE", email.ModeNone)
+	if err := loadSMTPTLSMode(); err != nil {
+		t.Fatal(err)
+	}
+	loadSMTPSecrets()
+	t.Cleanup(func() {
+		smtpTLSMode = email.ModeStartTLS
+		loadSMTPSecrets()
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/email-timecard", emailTimecardHandler)
+	mux.HandleFunc("/api/generate-and-email-timecard", generateAndEmailTimecardHandler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	entries := []Entry{}
+	for _, day := range []string{"2024-01-08", "2024-01-09", "2024-01-16", "2024-01-17"} {
+		for _, job := range []string{"234", "1017", "88"} {
+			entries = append(entries, Entry{Date: day + "T00:00:00Z", JobNumber: job, LabourCode: "227", Hours: 2.5})
+		}
+	}
+	timecard := TimecardRequest{
+		EmployeeName:  "Jane Doe",
+		PayPeriodNum:  3,
+		Year:          2024,
+		WeekStartDate: "2024-01-07T00:00:00Z",
+		Jobs: []Job{
+			{JobNumber: "234", JobName: "Plant"},
+			{JobNumber: "1017", JobName: "Substation"},
+			{JobNumber: "88", JobName: "Yard"},
+		},
+		Entries: entries,
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body any
+		want []string // attachment extensions
+	}{
+		{
+			name: "email-timecard",
+			path: "/api/email-timecard",
+			body: EmailTimecardRequest{TimecardRequest: timecard, To: "jane@example.com", Subject: "Timecard"},
+			want: []string{".xlsx"},
+		},
+		{
+			name: "generate-and-email with PDF",
+			path: "/api/generate-and-email-timecard",
+			body: GenerateAndEmailRequest{
+				EmailTimecardRequest: EmailTimecardRequest{TimecardRequest: timecard, To: "jane@example.com", Subject: "Timecard"},
+				IncludePDF:           true,
+			},
+			want: []string{".xlsx", ".pdf"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.Post(srv.URL+tt.path, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				msg, _ := io.ReadAll(resp.Body)
+				t.Fatalf("status = %d, body %s", resp.StatusCode, msg)
+			}
+			var raw string
+			select {
+			case raw = <-stub.messages:
+			default:
+				t.Fatal("SMTP stub received no message")
+			}
+			if len(stub.messages) != 0 {
+				t.Fatalf("SMTP stub received %d extra messages", len(stub.messages))
+			}
+			attachments := messageAttachments(t, raw)
+			if len(attachments) != len(tt.want) {
+				t.Fatalf("got %d attachments, want %d", len(attachments), len(tt.want))
+			}
+			for name, data := range attachments {
+				switch {
+				case strings.HasSuffix(name, ".xlsx"):
+					f, err := excelize.OpenReader(bytes.NewReader(data))
+					if err != nil {
+						t.Errorf("%s does not open: %v", name, err)
+						continue
+					}
+					f.Close()
+				case strings.HasSuffix(name, ".pdf"):
+					if !bytes.HasPrefix(data, []byte("%PDF-")) {
+						t.Errorf("%s is not a PDF", name)
+					}
+				default:
+					t.Errorf("unexpected attachment %s", name)
+				}
+			}
+			for _, ext := range tt.want {
+				found := false
+				for name := range attachments {
+					found = found || strings.HasSuffix(name, ext)
+				}
+				if !found {
+					t.Errorf("no %s attachment", ext)
+				}
+			}
+		})
+	}
+}
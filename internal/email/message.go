@@ -0,0 +1,88 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// bufPool recycles message buffers, which grow to the size of the
+// attachments, between sends.
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// Attachment is one file attached to an outgoing email.
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// Message builds a multipart/mixed message with body as its text part and
+// each attachment base64-encoded after it.
+func Message(from string, replyTo string, to []string, cc []string, subject string, body string, attachments []Attachment) string {
+	boundary := "==BOUNDARY=="
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufPool.Put(buf)
+	buf.WriteString(fmt.Sprintf("From: %s\r\n", sanitizeHeader(from)))
+	if replyTo != "" {
+		buf.WriteString(fmt.Sprintf("Reply-To: %s\r\n", sanitizeHeader(replyTo)))
+	}
+	buf.WriteString(fmt.Sprintf("To: %s\r\n", sanitizeHeader(strings.Join(to, ", "))))
+	if len(cc) > 0 {
+		buf.WriteString(fmt.Sprintf("Cc: %s\r\n", sanitizeHeader(strings.Join(cc, ", "))))
+	}
+	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", sanitizeHeader(subject)))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
+	buf.WriteString("\r\n")
+	buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	buf.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(body)
+	buf.WriteString("\r\n\r\n")
+	for _, attachment := range attachments {
+		buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		buf.WriteString(fmt.Sprintf("Content-Type: %s\r\n", sanitizeHeader(attachment.ContentType)))
+		buf.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", strings.ReplaceAll(sanitizeHeader(attachment.FileName), `"`, `\"`)))
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+		buf.WriteString("\r\n")
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for i := 0; i < len(encoded); i += 76 {
+			end := i + 76
+			if end > len(encoded) {
+				end = len(encoded)
+			}
+			buf.WriteString(encoded[i:end])
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	return buf.String()
+}
+
+// maxHeaderLength is RFC 5322's limit on a line, applied to header values.
+const maxHeaderLength = 998
+
+// headerBreaks turns every line break into a space.
+var headerBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// sanitizeHeader makes s safe to use as a header value: line breaks, which
+// would let a caller inject headers of their own, become spaces and the value
+// is cut to maxHeaderLength bytes without splitting a UTF-8 sequence.
+func sanitizeHeader(s string) string {
+	s = headerBreaks.Replace(s)
+	if len(s) > maxHeaderLength {
+		cut := maxHeaderLength
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package email
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMessageReplyTo(t *testing.T) {
+	tests := []struct {
+		name    string
+		replyTo string
+		want    string
+	}{
+		{name: "set", replyTo: "payroll@example.com", want: "payroll@example.com"},
+		{name: "unset", replyTo: "", want: ""},
+		{name: "header injection", replyTo: "a@example.com\r\nBcc: evil@example.com", want: "a@example.com Bcc: evil@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := Message(`"Payroll" <noreply@example.com>`, tt.replyTo, []string{"jane@example.com"}, nil, "Timecard", "See attached.", nil)
+			msg, err := mail.ReadMessage(strings.NewReader(raw))
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if got := msg.Header.Get("Reply-To"); got != tt.want {
+				t.Errorf("Reply-To = %q, want %q", got, tt.want)
+			}
+			if got := msg.Header.Get("Bcc"); got != "" {
+				t.Errorf("Bcc = %q, want no Bcc header", got)
+			}
+			if got := msg.Header.Get("From"); got != `"Payroll" <noreply@example.com>` {
+				t.Errorf("From = %q", got)
+			}
+		})
+	}
+}
+
+// BenchmarkMessage measures building a message around a workbook-sized
+// attachment; its buffer comes from bufPool.
+func BenchmarkMessage(b *testing.B) {
+	attachments := []Attachment{{
+		FileName:    "timecard.xlsx",
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		Data:        make([]byte, 70<<10),
+	}}
+	to := []string{"jane@example.com"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = Message("payroll@example.com", "", to, nil, "Timecard", "See attached.", attachments)
+	}
+}
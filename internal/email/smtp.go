@@ -0,0 +1,185 @@
+// Package email builds and delivers the server's SMTP messages. Choosing the
+// server, credentials and retry budget is left to the caller.
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"time"
+)
+
+// Transport security modes for Send.
+const (
+	ModeStartTLS = "starttls" // upgrade with STARTTLS when the server offers it
+	ModeTLS      = "tls"      // implicit TLS from the first byte, usually port 465
+	ModeNone     = "none"     // plaintext, for local relays only
+)
+
+// XOAuth2Auth returns an smtp.Auth for the AUTH XOAUTH2 mechanism. Like
+// smtp.PlainAuth it refuses to send the token over a connection that is not
+// encrypted, unless allowPlaintext is set for ModeNone.
+func XOAuth2Auth(username, accessToken string, allowPlaintext bool) smtp.Auth {
+	return &xoauth2Auth{username: username, accessToken: accessToken, allowPlaintext: allowPlaintext}
+}
+
+type xoauth2Auth struct {
+	username       string
+	accessToken    string
+	allowPlaintext bool
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !a.allowPlaintext {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	// net/smtp base64-encodes the initial response for us.
+	resp := fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", a.username, a.accessToken)
+	return "XOAUTH2", []byte(resp), nil
+}
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sends a JSON error challenge on failure; an empty reply lets it
+		// finish with the final error status.
+		slog.Warn("SMTP XOAUTH2 challenge", "response", string(fromServer))
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// PlaintextAuth is AUTH PLAIN without smtp.PlainAuth's refusal to send
+// credentials over an unencrypted connection, for use with ModeNone only.
+func PlaintextAuth(username, password string) smtp.Auth {
+	return &plaintextPlainAuth{username: username, password: password}
+}
+
+type plaintextPlainAuth struct {
+	username, password string
+}
+
+func (a *plaintextPlainAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "PLAIN", []byte("\x00" + a.username + "\x00" + a.password), nil
+}
+
+func (a *plaintextPlainAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("unexpected server challenge")
+	}
+	return nil, nil
+}
+
+// Send is smtp.SendMail with a context: the dial honours ctx and the
+// connection is closed if ctx is cancelled mid-conversation. mode picks
+// between STARTTLS, implicit TLS and plaintext.
+func Send(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte, mode string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var conn net.Conn
+	if mode == ModeTLS {
+		dialer := tls.Dialer{Config: &tls.Config{ServerName: host}}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && mode == ModeStartTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Retry runs fn up to maxAttempts times, backing off 1s, 2s, 4s, ... (±10% jitter)
+// between attempts. Only transient network failures are retried; SMTP 4xx/5xx replies
+// are returned immediately so a rejected message isn't resent. A cancelled ctx
+// ends the backoff early.
+func Retry(ctx context.Context, maxAttempts int, fn func() error) error {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = fn()
+		if err == nil || attempt == maxAttempts || !IsTransient(err) {
+			return err
+		}
+		delay := time.Duration(1<<(attempt-1)) * time.Second
+		jitter := time.Duration((rand.Float64()*0.2 - 0.1) * float64(delay))
+		delay += jitter
+		slog.WarnContext(ctx, "SMTP send attempt failed, retrying",
+			"attempt", attempt,
+			"max_attempts", maxAttempts,
+			"error", err,
+			"retry_in", delay.Round(time.Millisecond).String(),
+		)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+var smtpReplyCodeRegex = regexp.MustCompile(`^[45]\d{2}[ -]`)
+
+// IsTransient reports whether err is a network-level failure worth retrying.
+func IsTransient(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) || smtpReplyCodeRegex.MatchString(err.Error()) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,140 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpSession is what fakeSMTPServer saw of one client connection.
+type smtpSession struct {
+	from string
+	rcpt []string
+	data string
+}
+
+// fakeSMTPServer accepts one plaintext SMTP session on a loopback port and
+// sends what it received on the returned channel.
+func fakeSMTPServer(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var s smtpSession
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 fake")
+			case "MAIL":
+				s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+				tp.PrintfLine("250 OK")
+			case "RCPT":
+				s.rcpt = append(s.rcpt, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := io.ReadAll(tp.DotReader())
+				if err != nil {
+					return
+				}
+				s.data = string(data)
+				tp.PrintfLine("250 OK")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				sessions <- s
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), sessions
+}
+
+func TestSend(t *testing.T) {
+	addr, sessions := fakeSMTPServer(t)
+	attachment := []byte("PK\x03\x04 not really a workbook")
+	msg := Message("payroll@example.com", "", []string{"jane@example.com"}, []string{"boss@example.com"},
+		"Timecard", "See attached.", []Attachment{{
+			FileName:    "Timecard_Jane_Doe.xlsx",
+			ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			Data:        attachment,
+		}})
+	rcpt := []string{"jane@example.com", "boss@example.com"}
+	if err := Send(context.Background(), addr, nil, "payroll@example.com", rcpt, []byte(msg), ModeNone); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	s := <-sessions
+	if s.from != "payroll@example.com" {
+		t.Errorf("MAIL FROM = %q", s.from)
+	}
+	if strings.Join(s.rcpt, ",") != strings.Join(rcpt, ",") {
+		t.Errorf("RCPT TO = %v, want %v", s.rcpt, rcpt)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(s.data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	for header, want := range map[string]string{
+		"From": "payroll@example.com",
+		"To":   "jane@example.com",
+		"Cc":   "boss@example.com",
+	} {
+		if got := m.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type: %v", err)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	if _, err := mr.NextPart(); err != nil { // text body
+		t.Fatalf("body part: %v", err)
+	}
+	part, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("attachment part: %v", err)
+	}
+	if got, want := part.Header.Get("Content-Disposition"), `attachment; filename="Timecard_Jane_Doe.xlsx"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	if got := part.Header.Get("Content-Transfer-Encoding"); got != "base64" {
+		t.Errorf("Content-Transfer-Encoding = %q, want base64", got)
+	}
+	encoded, err := io.ReadAll(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil {
+		t.Fatalf("attachment is not base64: %v", err)
+	}
+	if string(decoded) != string(attachment) {
+		t.Errorf("attachment = %q, want %q", decoded, attachment)
+	}
+}
@@ -0,0 +1,103 @@
+// Package excel holds workbook helpers that don't depend on the timecard
+// request types: style-preserving cell writes and the zip-level fixes applied
+// to every generated workbook.
+package excel
+
+import (
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// SetCellPreserveStyle writes a value into a cell while preserving the cell's original style (borders, number formats, alignment, etc).
+// This is useful because some Excel clients will "repair" workbooks if the calc chain/style graph is inconsistent,
+// and the repair process can strip formatting. We keep the template style intact by re-applying it after writes.
+func SetCellPreserveStyle(f *excelize.File, sheet, cell string, value any) error {
+	styleID, _ := f.GetCellStyle(sheet, cell) // ignore errors; styleID=0 means "no explicit style"
+	if err := f.SetCellValue(sheet, cell, value); err != nil {
+		return err
+	}
+	if styleID != 0 {
+		_ = f.SetCellStyle(sheet, cell, cell, styleID)
+	}
+	return nil
+}
+
+// Built-in Excel number formats for values the server writes.
+const (
+	HoursNumFmt = 2  // 0.00
+	DateNumFmt  = 14 // short date
+)
+
+// SetNumberPreserveStyle writes a number with SetCellPreserveStyle and, when
+// the template leaves the cell as General, gives it numFmt so Excel can't
+// guess a date or drop decimals. A format the template already sets wins.
+func SetNumberPreserveStyle(f *excelize.File, sheet, cell string, value any, numFmt int) error {
+	styleID, _ := f.GetCellStyle(sheet, cell)
+	if err := f.SetCellValue(sheet, cell, value); err != nil {
+		return err
+	}
+	style := &excelize.Style{}
+	if styleID != 0 {
+		existing, err := f.GetStyle(styleID)
+		if err != nil {
+			return f.SetCellStyle(sheet, cell, cell, styleID)
+		}
+		style = existing
+	}
+	if style.NumFmt != 0 || (style.CustomNumFmt != nil && *style.CustomNumFmt != "") {
+		if styleID == 0 {
+			return nil
+		}
+		return f.SetCellStyle(sheet, cell, cell, styleID)
+	}
+	style.NumFmt = numFmt
+	// NewStyle returns the existing ID when an identical style is already defined.
+	formatted, err := f.NewStyle(style)
+	if err != nil {
+		return err
+	}
+	return f.SetCellStyle(sheet, cell, cell, formatted)
+}
+
+// SetFillPreserveStyle gives a cell a solid fill of the RGB hex color while
+// keeping the rest of its style (borders, fonts, number format).
+func SetFillPreserveStyle(f *excelize.File, sheet, cell, color string) error {
+	styleID, _ := f.GetCellStyle(sheet, cell)
+	style := &excelize.Style{}
+	if styleID != 0 {
+		existing, err := f.GetStyle(styleID)
+		if err != nil {
+			return err
+		}
+		style = existing
+	}
+	style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{color}}
+	filled, err := f.NewStyle(style)
+	if err != nil {
+		return err
+	}
+	return f.SetCellStyle(sheet, cell, cell, filled)
+}
+
+// SanitizeInput prefixes user-supplied text that a spreadsheet would
+// read as a formula (leading =, +, -, @ or tab) with a single quote so it is
+// shown as a literal string.
+func SanitizeInput(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t':
+		return "'" + s
+	}
+	return s
+}
+
+// DateSerial converts t to an Excel date serial number (days since
+// 1899-12-30).
+func DateSerial(t time.Time) float64 {
+	excelEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	duration := t.Sub(excelEpoch)
+	return duration.Hours() / 24.0
+}
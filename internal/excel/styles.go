@@ -0,0 +1,112 @@
+package excel
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// styleCollections are the styles.xml lists that cell styles index into, in
+// the order the schema requires them.
+var styleCollections = []string{"numFmts", "fonts", "fills", "borders", "cellXfs"}
+
+var countAttr = regexp.MustCompile(`\scount="\d+"`)
+
+// mergeAddedStyles carries styles added while filling a workbook over to the
+// template's original styles.xml. excelize only ever appends to these lists,
+// so anything past the original length in generated is new; it is appended to
+// original unchanged and every existing index keeps its meaning.
+func mergeAddedStyles(original, generated []byte) ([]byte, error) {
+	merged := original
+	for _, name := range styleCollections {
+		origSpan, origChildren, err := styleChildren(merged, name)
+		if err != nil {
+			return nil, err
+		}
+		_, genChildren, err := styleChildren(generated, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(genChildren) <= len(origChildren) {
+			continue
+		}
+		if origSpan == nil {
+			return nil, fmt.Errorf("styles.xml: template has no <%s> to add styles to", name)
+		}
+		var added bytes.Buffer
+		for _, child := range genChildren[len(origChildren):] {
+			added.Write(generated[child[0]:child[1]])
+		}
+		// origSpan covers <name ...> through </name>; insert before the end tag
+		// and fix up the count attribute on the start tag.
+		block := merged[origSpan[0]:origSpan[1]]
+		closeAt := bytes.LastIndex(block, []byte("</"))
+		if closeAt < 0 {
+			return nil, fmt.Errorf("styles.xml: <%s> is self-closing", name)
+		}
+		startEnd := bytes.IndexByte(block, '>') + 1
+		startTag := block[:startEnd]
+		count := fmt.Sprintf(` count="%d"`, len(genChildren))
+		if countAttr.Match(startTag) {
+			startTag = countAttr.ReplaceAll(startTag, []byte(count))
+		} else {
+			startTag = append(append(append([]byte{}, startTag[:len(startTag)-1]...), count...), '>')
+		}
+		var out bytes.Buffer
+		out.Write(merged[:origSpan[0]])
+		out.Write(startTag)
+		out.Write(block[startEnd:closeAt])
+		out.Write(added.Bytes())
+		out.Write(block[closeAt:])
+		out.Write(merged[origSpan[1]:])
+		merged = out.Bytes()
+	}
+	return merged, nil
+}
+
+// styleChildren finds the top-level <name> list in a styles.xml and the byte
+// ranges of its child elements. span is nil when the list is absent.
+func styleChildren(data []byte, name string) (span []int64, children [][2]int64, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	var childStart int64
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			return span, children, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("styles.xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 && t.Name.Local == name {
+				span = []int64{offset, 0}
+			} else if depth == 3 && span != nil && span[1] == 0 {
+				childStart = offset
+			}
+		case xml.EndElement:
+			if depth == 3 && span != nil && span[1] == 0 {
+				children = append(children, [2]int64{childStart, dec.InputOffset()})
+			} else if depth == 2 && span != nil && span[1] == 0 && t.Name.Local == name {
+				span[1] = dec.InputOffset()
+			}
+			depth--
+		}
+	}
+}
+
+func readZipFile(zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
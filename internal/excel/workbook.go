@@ -0,0 +1,250 @@
+package excel
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// bufPool recycles the buffers workbooks are rewritten into. Results are
+// copied out, so a pooled buffer never escapes.
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// ForceRecalc post-processes an XLSX to:
+// 1) remove xl/calcChain.xml (and related references), and
+// 2) ensure Excel recalculates formulas when the file is opened.
+func ForceRecalc(xlsx []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(xlsx), int64(len(xlsx)))
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx zip: %w", err)
+	}
+	out := bufPool.Get().(*bytes.Buffer)
+	out.Reset()
+	defer bufPool.Put(out)
+	zw := zip.NewWriter(out)
+	for _, zf := range zr.File {
+		name := zf.Name
+		// Drop calcChain entirely (stale calcChain is the common cause of "formulas show but values don't update")
+		if name == "xl/calcChain.xml" {
+			continue
+		}
+		// For files we need to modify, read into memory
+		needsModification := name == "xl/workbook.xml" || name == "xl/_rels/workbook.xml.rels" || name == "[Content_Types].xml"
+		if needsModification {
+			rc, err := zf.Open()
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+			b, err := io.ReadAll(rc)
+			_ = rc.Close()
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+			switch name {
+			case "xl/workbook.xml":
+				b = ensureCalcPrAutoFull(b)
+			case "xl/_rels/workbook.xml.rels":
+				b = removeCalcChainRelationships(b)
+			case "[Content_Types].xml":
+				b = removeCalcChainContentType(b)
+			}
+			// Create new header, preserving original compression method
+			hdr := zf.FileHeader
+			// Force Store (no compression) for modified files to avoid recompression issues
+			hdr.Method = zip.Store
+			w, err := zw.CreateHeader(&hdr)
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("write %s: %w", name, err)
+			}
+			if _, err := w.Write(b); err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("write %s: %w", name, err)
+			}
+		} else {
+			// For files we don't modify (like styles.xml), copy raw compressed bytes
+			// This preserves the exact compression and avoids corruption
+			// Use OpenRaw() to get compressed bytes without decompression
+			rc, err := zf.OpenRaw()
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("open raw %s: %w", name, err)
+			}
+			// Get compressed size
+			compressedSize := int64(zf.CompressedSize64)
+			if compressedSize == 0 {
+				compressedSize = int64(zf.CompressedSize)
+			}
+			// Create raw writer to preserve compression
+			hdr := zf.FileHeader
+			w, err := zw.CreateRaw(&hdr)
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("create raw %s: %w", name, err)
+			}
+			// Copy raw compressed bytes
+			// Note: OpenRaw() returns io.Reader (not io.ReadCloser), so no Close() needed
+			if _, err := io.CopyN(w, rc, compressedSize); err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("copy raw %s: %w", name, err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("finalize xlsx zip: %w", err)
+	}
+	return bytes.Clone(out.Bytes()), nil
+}
+
+// StylesXML extracts styles.xml from a template workbook, so the exact
+// formatting can be put back after excelize rewrites it.
+func StylesXML(xlsx []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(xlsx), int64(len(xlsx)))
+	if err != nil {
+		return nil, fmt.Errorf("open template zip: %w", err)
+	}
+	for _, zf := range zr.File {
+		if zf.Name == "xl/styles.xml" {
+			data, err := readZipFile(zf)
+			if err != nil {
+				return nil, fmt.Errorf("read styles.xml: %w", err)
+			}
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("styles.xml not found in template")
+}
+
+// RestoreStylesXML replaces the styles.xml in the Excel file with the original
+// from the template, keeping any styles added while filling it (see
+// mergeAddedStyles).
+func RestoreStylesXML(excelData []byte, originalStylesXML []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(excelData), int64(len(excelData)))
+	if err != nil {
+		return nil, fmt.Errorf("open excel zip: %w", err)
+	}
+	out := bufPool.Get().(*bytes.Buffer)
+	out.Reset()
+	defer bufPool.Put(out)
+	zw := zip.NewWriter(out)
+	for _, zf := range zr.File {
+		if zf.Name == "xl/styles.xml" {
+			generated, err := readZipFile(zf)
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("read styles.xml: %w", err)
+			}
+			stylesXML, err := mergeAddedStyles(originalStylesXML, generated)
+			if err != nil {
+				_ = zw.Close()
+				return nil, err
+			}
+			hdr := zf.FileHeader
+			hdr.Method = zip.Store // Use Store (no compression) for XML
+			w, err := zw.CreateHeader(&hdr)
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("create styles.xml: %w", err)
+			}
+			if _, err := w.Write(stylesXML); err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("write styles.xml: %w", err)
+			}
+		} else {
+			// Copy all other files as-is using raw copy to preserve compression
+			if zf.Name == "xl/calcChain.xml" {
+				continue // Skip calcChain
+			}
+			// Use raw copy for unmodified files to preserve exact compression
+			rc, err := zf.OpenRaw()
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("open raw %s: %w", zf.Name, err)
+			}
+			compressedSize := int64(zf.CompressedSize64)
+			if compressedSize == 0 {
+				compressedSize = int64(zf.CompressedSize)
+			}
+			hdr := zf.FileHeader
+			w, err := zw.CreateRaw(&hdr)
+			if err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("create raw %s: %w", zf.Name, err)
+			}
+			if _, err := io.CopyN(w, rc, compressedSize); err != nil {
+				_ = zw.Close()
+				return nil, fmt.Errorf("copy raw %s: %w", zf.Name, err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("finalize zip: %w", err)
+	}
+	return bytes.Clone(out.Bytes()), nil
+}
+func ensureCalcPrAutoFull(b []byte) []byte {
+	s := string(b)
+	// Match calcPr element - handles both:
+	// 1. Self-closing: <calcPr calcId="123"/>
+	// 2. Open/close pair: <calcPr calcId="123"></calcPr>
+	reSelfClosing := regexp.MustCompile(`<calcPr([^>]*)/\s*>`)
+	reOpenClose := regexp.MustCompile(`<calcPr([^>]*)>\s*</calcPr>`)
+	// Try self-closing first
+	if loc := reSelfClosing.FindStringIndex(s); loc != nil {
+		attrs := reSelfClosing.FindStringSubmatch(s)[1]
+		newCalcPr := buildCalcPrElement(attrs)
+		s = s[:loc[0]] + newCalcPr + s[loc[1]:]
+		return []byte(s)
+	}
+	// Try open/close pair
+	if loc := reOpenClose.FindStringIndex(s); loc != nil {
+		attrs := reOpenClose.FindStringSubmatch(s)[1]
+		newCalcPr := buildCalcPrElement(attrs)
+		s = s[:loc[0]] + newCalcPr + s[loc[1]:]
+		return []byte(s)
+	}
+	// No calcPr found -> insert a minimal one before </workbook>
+	insert := `<calcPr calcId="1" calcMode="auto" fullCalcOnLoad="1"/>`
+	if strings.Contains(s, "</workbook>") {
+		s = strings.Replace(s, "</workbook>", insert+"</workbook>", 1)
+		return []byte(s)
+	}
+	return b
+}
+
+// buildCalcPrElement creates a calcPr element with the required attributes
+func buildCalcPrElement(existingAttrs string) string {
+	attrs := existingAttrs
+	// Ensure calcMode="auto"
+	if regexp.MustCompile(`calcMode="[^"]*"`).MatchString(attrs) {
+		attrs = regexp.MustCompile(`calcMode="[^"]*"`).ReplaceAllString(attrs, `calcMode="auto"`)
+	} else {
+		attrs = ` calcMode="auto"` + attrs
+	}
+	// Ensure fullCalcOnLoad="1"
+	if regexp.MustCompile(`fullCalcOnLoad="[^"]*"`).MatchString(attrs) {
+		attrs = regexp.MustCompile(`fullCalcOnLoad="[^"]*"`).ReplaceAllString(attrs, `fullCalcOnLoad="1"`)
+	} else {
+		attrs = ` fullCalcOnLoad="1"` + attrs
+	}
+	return `<calcPr` + attrs + `/>`
+}
+func removeCalcChainRelationships(b []byte) []byte {
+	s := string(b)
+	// Remove any relationship entries that reference calcChain (by Type or Target)
+	re := regexp.MustCompile(`(?s)<Relationship[^>]*(?:calcChain)[^>]*/>`)
+	s = re.ReplaceAllString(s, "")
+	return []byte(s)
+}
+func removeCalcChainContentType(b []byte) []byte {
+	s := string(b)
+	re := regexp.MustCompile(`(?s)<Override[^>]*PartName="/xl/calcChain\.xml"[^>]*/>`)
+	s = re.ReplaceAllString(s, "")
+	return []byte(s)
+}
@@ -0,0 +1,44 @@
+package excel
+
+import (
+	"os"
+	"testing"
+)
+
+// readTemplate loads the server's timecard template from the module root.
+func readTemplate(b *testing.B) []byte {
+	b.Helper()
+	data, err := os.ReadFile("../../template.xlsx")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+// BenchmarkForceRecalc and BenchmarkRestoreStylesXML measure the workbook
+// rewrites, whose output buffers come from bufPool.
+func BenchmarkForceRecalc(b *testing.B) {
+	xlsx := readTemplate(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ForceRecalc(xlsx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRestoreStylesXML(b *testing.B) {
+	xlsx := readTemplate(b)
+	styles, err := StylesXML(xlsx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := RestoreStylesXML(xlsx, styles); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package pdf
+
+import (
+	"context"
+	"os"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Converter turns a generated workbook into a PDF. Converters work on files
+// so ones backed by external tools can share the interface.
+type Converter interface {
+	Name() string
+	Convert(ctx context.Context, excelPath, pdfPath string) error
+}
+
+// GoFPDF renders the workbook in-process with RenderWorkbook.
+type GoFPDF struct{}
+
+// Name implements Converter.
+func (GoFPDF) Name() string { return "gofpdf" }
+
+// Convert implements Converter.
+func (GoFPDF) Convert(ctx context.Context, excelPath, pdfPath string) error {
+	f, err := excelize.OpenFile(excelPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pdfData, err := RenderWorkbook(ctx, f)
+	if err != nil {
+		return err
+	}
+	return WritePrivateFile(pdfPath, pdfData)
+}
+
+// WritePrivateFile writes data to a new file only its owner can read. It
+// fails if path already exists rather than write through whatever is there.
+func WritePrivateFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,316 @@
+// Package pdf renders generated workbooks as PDF and defines the converter
+// interface the server chains PDF backends through.
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Page geometry for rendered workbooks: landscape US Letter, in points.
+const (
+	pdfPageWidth     = 792.0
+	pdfPageHeight    = 612.0
+	pdfMargin        = 36.0
+	pdfFooterHeight  = 18.0
+	pdfFooterSize    = 8.0
+	pdfMaxFontSize   = 9.0
+	pdfMinFontSize   = 4.0
+	pdfMaxCellChars  = 50
+	pdfHeaderRows    = 4
+	pdfCellPaddingEm = 0.5
+	pdfShadeGray     = 237 // 0.93 of white
+)
+
+// RenderWorkbook draws every visible sheet of f as a plain table: column
+// widths follow their longest value (capped at pdfMaxCellChars), the first
+// rows are bold, numbers are right-aligned and alternate rows are shaded. Each
+// page footer names the sheet and page.
+func RenderWorkbook(ctx context.Context, f *excelize.File) ([]byte, error) {
+	doc := gofpdf.New("L", "pt", "Letter", "")
+	doc.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	doc.SetAutoPageBreak(false, 0)
+	// Lay every sheet out first so the footers know the page count.
+	var layouts []sheetLayout
+	pages := 0
+	for _, sheet := range f.GetSheetList() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if visible, _ := f.GetSheetVisible(sheet); !visible {
+			continue
+		}
+		grid, err := sheetGrid(f, sheet)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", sheet, err)
+		}
+		if len(grid) == 0 {
+			continue
+		}
+		layout := layoutSheet(doc, sheet, grid)
+		layouts = append(layouts, layout)
+		pages += layout.pages()
+	}
+	if len(layouts) == 0 {
+		doc.AddPage()
+		drawFooter(doc, "", 1, 1)
+	}
+	page := 0
+	for _, layout := range layouts {
+		page = renderSheetPages(doc, layout, page, pages)
+	}
+	var buf bytes.Buffer
+	if err := doc.Output(&buf); err != nil {
+		return nil, fmt.Errorf("writing PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawFooter writes the right-aligned "sheet - Page n of m" footer.
+func drawFooter(doc *gofpdf.Fpdf, sheet string, page, pages int) {
+	footer := fmt.Sprintf("Page %d of %d", page, pages)
+	if sheet != "" {
+		footer = sheet + " - " + footer
+	}
+	footer = winAnsi(footer)
+	doc.SetFont("Helvetica", "", pdfFooterSize)
+	doc.Text(pdfPageWidth-pdfMargin-doc.GetStringWidth(footer), pdfPageHeight-pdfMargin/2, footer)
+}
+
+// pdfCell is one cell of a rendered sheet. span is the number of columns a
+// merged cell covers; cells hidden under a merge have span 0.
+type pdfCell struct {
+	text string
+	span int
+}
+
+// sheetGrid reads the visible cells of a sheet's used range as display text,
+// evaluating formulas that have no cached value (generated workbooks are
+// recalculated by Excel on open, so their formulas start empty). Trailing empty
+// rows and columns that are empty all the way down are dropped.
+func sheetGrid(f *excelize.File, sheet string) ([][]pdfCell, error) {
+	dimension, err := f.GetSheetDimension(sheet)
+	if err != nil {
+		return nil, err
+	}
+	first, last, _ := strings.Cut(dimension, ":")
+	if last == "" {
+		last = first
+	}
+	maxCol, maxRow, err := excelize.CellNameToCoordinates(last)
+	if err != nil {
+		return nil, err
+	}
+	merges, err := f.GetMergeCells(sheet)
+	if err != nil {
+		return nil, err
+	}
+	covered := map[[2]int]bool{}
+	mergeEnd := map[[2]int]int{}
+	for _, merge := range merges {
+		c1, r1, err1 := excelize.CellNameToCoordinates(merge.GetStartAxis())
+		c2, r2, err2 := excelize.CellNameToCoordinates(merge.GetEndAxis())
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		mergeEnd[[2]int{r1, c1}] = c2
+		for r := r1; r <= r2; r++ {
+			for c := c1; c <= c2; c++ {
+				if r != r1 || c != c1 {
+					covered[[2]int{r, c}] = true
+				}
+			}
+		}
+	}
+	var cols []int
+	for c := 1; c <= maxCol; c++ {
+		name, _ := excelize.ColumnNumberToName(c)
+		if visible, _ := f.GetColVisible(sheet, name); visible {
+			cols = append(cols, c)
+		}
+	}
+	var grid [][]pdfCell
+	var rowNums []int
+	lastUsed := 0
+	keep := make([]bool, len(cols))
+	for r := 1; r <= maxRow; r++ {
+		if visible, _ := f.GetRowVisible(sheet, r); !visible {
+			continue
+		}
+		row := make([]pdfCell, len(cols))
+		used := false
+		for i, c := range cols {
+			if covered[[2]int{r, c}] {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(c, r)
+			value, _ := f.GetCellValue(sheet, cell)
+			if value == "" {
+				if formula, _ := f.GetCellFormula(sheet, cell); formula != "" {
+					value, _ = f.CalcCellValue(sheet, cell)
+				}
+			}
+			value = strings.Join(strings.Fields(value), " ")
+			if len([]rune(value)) > pdfMaxCellChars {
+				value = string([]rune(value)[:pdfMaxCellChars])
+			}
+			row[i] = pdfCell{text: value, span: 1}
+			if value != "" {
+				used = true
+				keep[i] = true
+			}
+		}
+		grid = append(grid, row)
+		rowNums = append(rowNums, r)
+		if used {
+			lastUsed = len(grid)
+		}
+	}
+	grid = grid[:lastUsed]
+	for g, row := range grid {
+		var trimmed []pdfCell
+		for i, cell := range row {
+			if !keep[i] {
+				continue
+			}
+			if end, ok := mergeEnd[[2]int{rowNums[g], cols[i]}]; ok {
+				cell.span = 0
+				for k := i; k < len(cols) && cols[k] <= end; k++ {
+					if keep[k] {
+						cell.span++
+					}
+				}
+			}
+			trimmed = append(trimmed, cell)
+		}
+		grid[g] = trimmed
+	}
+	return grid, nil
+}
+
+// sheetLayout is a sheet's grid with the font size and column widths chosen
+// to fit it across the page.
+type sheetLayout struct {
+	sheet     string
+	grid      [][]pdfCell
+	size      float64
+	widths    []float64
+	rowHeight float64
+}
+
+// rowsPerPage is how many rows fit between the top margin and the footer.
+func (l sheetLayout) rowsPerPage() int {
+	return max(1, int((pdfPageHeight-2*pdfMargin-pdfFooterHeight)/l.rowHeight))
+}
+
+func (l sheetLayout) pages() int {
+	perPage := l.rowsPerPage()
+	return (len(l.grid) + perPage - 1) / perPage
+}
+
+// layoutSheet sizes grid's columns from the widest single-column value in
+// each, measured in the bold font so header rows fit too.
+func layoutSheet(doc *gofpdf.Fpdf, sheet string, grid [][]pdfCell) sheetLayout {
+	ncols := len(grid[0])
+	doc.SetFont("Helvetica", "B", 1)
+	ems := make([]float64, ncols)
+	for _, row := range grid {
+		for i, cell := range row {
+			if cell.span == 1 {
+				ems[i] = max(ems[i], doc.GetStringWidth(winAnsi(cell.text)))
+			}
+		}
+	}
+	total := 0.0
+	for i := range ems {
+		ems[i] = max(ems[i], 0.5) + 2*pdfCellPaddingEm
+		total += ems[i]
+	}
+	usableWidth := pdfPageWidth - 2*pdfMargin
+	size := min(pdfMaxFontSize, max(pdfMinFontSize, usableWidth/total))
+	// At the smallest font the columns may still be too wide; squeeze them
+	// and let long values truncate.
+	scale := min(1, usableWidth/(total*size))
+	widths := make([]float64, ncols)
+	for i := range ems {
+		widths[i] = ems[i] * size * scale
+	}
+	return sheetLayout{sheet: sheet, grid: grid, size: size, widths: widths, rowHeight: size * 1.6}
+}
+
+// renderSheetPages draws layout from page page+1 on and returns the number of
+// the last page it drew; pages is the document's page count.
+func renderSheetPages(doc *gofpdf.Fpdf, layout sheetLayout, page, pages int) int {
+	size, widths, rowHeight := layout.size, layout.widths, layout.rowHeight
+	perPage := layout.rowsPerPage()
+	ncols := len(widths)
+	doc.SetFillColor(pdfShadeGray, pdfShadeGray, pdfShadeGray)
+	y := 0.0
+	for r, row := range layout.grid {
+		if r%perPage == 0 {
+			doc.AddPage()
+			page++
+			drawFooter(doc, layout.sheet, page, pages)
+			y = pdfMargin
+		}
+		header := r < pdfHeaderRows
+		if !header && (r-pdfHeaderRows)%2 == 1 {
+			doc.Rect(pdfMargin, y, sumWidths(widths), rowHeight, "F")
+		}
+		style := ""
+		if header {
+			style = "B"
+		}
+		doc.SetFont("Helvetica", style, size)
+		x := pdfMargin
+		for i, cell := range row {
+			width := widths[i]
+			if cell.span > 1 {
+				width = sumWidths(widths[i:min(i+cell.span, ncols)])
+			}
+			if value := winAnsi(cell.text); value != "" {
+				room := width - 2*pdfCellPaddingEm*size
+				for len(value) > 1 && doc.GetStringWidth(value) > room {
+					value = value[:len(value)-1]
+				}
+				textX := x + pdfCellPaddingEm*size
+				if _, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64); err == nil {
+					textX = x + width - pdfCellPaddingEm*size - doc.GetStringWidth(value)
+				}
+				doc.Text(textX, y+rowHeight*0.7, value)
+			}
+			x += widths[i]
+		}
+		y += rowHeight
+	}
+	return page
+}
+
+func sumWidths(widths []float64) float64 {
+	total := 0.0
+	for _, w := range widths {
+		total += w
+	}
+	return total
+}
+
+// winAnsi encodes s in the WinAnsi (cp1252) encoding gofpdf's core fonts
+// use, replacing anything it cannot represent with '?'.
+func winAnsi(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			c = '?'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
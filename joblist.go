@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// serverJobs is the job list loaded from JOBS_FILE (default jobs.json). Requests
+// that don't send their own jobs fall back to it.
+var serverJobs struct {
+	sync.RWMutex
+	jobs []Job
+}
+
+func jobsFilePath() string {
+	if path := os.Getenv("JOBS_FILE"); path != "" {
+		return path
+	}
+	return "jobs.json"
+}
+
+// loadJobList (re)reads the job list file. A missing file means an empty list; a
+// malformed one keeps the current list so a bad edit can't wipe it on SIGHUP.
+func loadJobList() {
+	path := jobsFilePath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("job list file not found, server-side job list is empty", "path", path)
+		return
+	}
+	if err != nil {
+		slog.Error("could not read job list", "path", path, "error", err)
+		return
+	}
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		slog.Error("could not parse job list, keeping previous list", "path", path, "error", err)
+		return
+	}
+	serverJobs.Lock()
+	serverJobs.jobs = jobs
+	serverJobs.Unlock()
+	slog.Info("job list loaded", "path", path, "jobs", len(jobs))
+}
+
+// defaultJobs returns a copy of the server-side job list.
+func defaultJobs() []Job {
+	serverJobs.RLock()
+	defer serverJobs.RUnlock()
+	return append([]Job(nil), serverJobs.jobs...)
+}
+
+// saveJobList writes jobs to the job list file via a temp file and rename so a
+// crash mid-write can't leave a truncated file. Callers hold serverJobs.Lock.
+func saveJobList(jobs []Job) error {
+	path := jobsFilePath()
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".jobs-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// listJobsHandler handles GET /api/jobs.
+func listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(defaultJobs())
+}
+
+// addServerJobHandler handles POST /admin/jobs: it appends a job and writes the
+// job list file back.
+func addServerJobHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var job Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	job.JobNumber = strings.TrimSpace(job.JobNumber)
+	if job.JobNumber == "" {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: job_number is required"})
+		return
+	}
+	serverJobs.Lock()
+	defer serverJobs.Unlock()
+	for _, existing := range serverJobs.jobs {
+		if existing.JobNumber == job.JobNumber {
+			respondError(w, r, http.StatusConflict, APIError{Code: ErrConflict, Message: "Job already exists"})
+			return
+		}
+	}
+	jobs := append(append([]Job(nil), serverJobs.jobs...), job)
+	if err := saveJobList(jobs); err != nil {
+		slog.ErrorContext(ctx, "could not save job list", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error saving job list"})
+		return
+	}
+	serverJobs.jobs = jobs
+	// Cached workbooks of requests without their own jobs used the old list.
+	workbookCache.Purge()
+	slog.InfoContext(ctx, "job added", "job_number", job.JobNumber, "job_name", job.JobName)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(job)
+}
+
+// deleteServerJobHandler handles DELETE /admin/jobs/{job_number}.
+func deleteServerJobHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PathValue("job_number")
+	serverJobs.Lock()
+	defer serverJobs.Unlock()
+	jobs := make([]Job, 0, len(serverJobs.jobs))
+	for _, existing := range serverJobs.jobs {
+		if existing.JobNumber != code {
+			jobs = append(jobs, existing)
+		}
+	}
+	if len(jobs) == len(serverJobs.jobs) {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "Job not found"})
+		return
+	}
+	if err := saveJobList(jobs); err != nil {
+		slog.ErrorContext(ctx, "could not save job list", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error saving job list"})
+		return
+	}
+	serverJobs.jobs = jobs
+	// Cached workbooks of requests without their own jobs used the old list.
+	workbookCache.Purge()
+	slog.InfoContext(ctx, "job removed", "job_number", code)
+	w.WriteHeader(http.StatusNoContent)
+}
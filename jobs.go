@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Async job states reported by GET /api/jobs/{id}.
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusError   = "error"
+)
+
+// GenerateJob is a queued async timecard generation.
+type GenerateJob struct {
+	ID        string
+	RequestID string
+	Tenant    *TenantConfig
+	Request   TimecardRequest
+}
+
+// JobStatus tracks an async job and holds the generated workbook until the job expires.
+type JobStatus struct {
+	mu           sync.Mutex
+	ID           string
+	TenantID     string
+	Status       string
+	EmployeeName string
+	ErrorMessage string
+	ExcelData    []byte
+	CreatedAt    time.Time
+	CompletedAt  time.Time
+	// Stage and Percent are the latest progress report; progressChanged is
+	// closed and replaced on every change (see setProgress).
+	Stage           string
+	Percent         int
+	progressChanged chan struct{}
+}
+
+var (
+	jobStatuses sync.Map // job ID -> *JobStatus
+	jobTTL      = 30 * time.Minute
+)
+
+// initAsyncJobs starts a sweeper that drops jobs older than JOB_TTL_MINUTES
+// (default 30). The jobs themselves run on generatePool.
+func initAsyncJobs() {
+	if ttl := getEnvInt("JOB_TTL_MINUTES", 30); ttl > 0 {
+		jobTTL = time.Duration(ttl) * time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			evictExpiredJobs(time.Now().Add(-jobTTL))
+		}
+	}()
+	slog.Info("async jobs enabled", "ttl", jobTTL.String())
+}
+func processGenerateJob(job GenerateJob) {
+	value, ok := jobStatuses.Load(job.ID)
+	if !ok {
+		return
+	}
+	status := value.(*JobStatus)
+	status.mu.Lock()
+	status.Status = JobStatusRunning
+	status.setProgress(ProgressGenerating, 0)
+	status.mu.Unlock()
+	ctx := context.WithValue(context.Background(), requestIDKey{}, job.RequestID)
+	ctx = context.WithValue(ctx, tenantKey{}, job.Tenant)
+	ctx = withProgress(ctx, func(stage string, percent int) {
+		status.mu.Lock()
+		status.setProgress(stage, percent)
+		status.mu.Unlock()
+	})
+	start := time.Now()
+	excelData, err := buildTimecardWorkbook(ctx, job.Request)
+	status.mu.Lock()
+	status.CompletedAt = time.Now()
+	if err != nil {
+		status.Status = JobStatusError
+		status.ErrorMessage = err.Error()
+		status.setProgress(ProgressError, status.Percent)
+		slog.ErrorContext(ctx, "async job failed", "job_id", job.ID, "error", err)
+	} else {
+		status.Status = JobStatusDone
+		status.ExcelData = excelData
+		status.setProgress(ProgressDone, 100)
+		slog.InfoContext(ctx, "async job completed",
+			"job_id", job.ID,
+			"employee_name", job.Request.EmployeeName,
+			"bytes", len(excelData),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+	finalStatus := status.Status
+	status.mu.Unlock()
+	if strings.TrimSpace(job.Request.WebhookURL) != "" {
+		notifyJobWebhook(ctx, job, finalStatus)
+	}
+}
+
+// jobDownloadURL is the path clients use to fetch a finished job's workbook.
+func jobDownloadURL(id string) string {
+	return fmt.Sprintf("/v%s/api/files/%s/excel", apiVersion, id)
+}
+
+// webhookClient applies the employee photo guard to webhook deliveries: the
+// dialled address must be public and redirects are re-validated.
+var webhookClient = &http.Client{
+	Timeout:       10 * time.Second,
+	Transport:     photoClient.Transport,
+	CheckRedirect: photoClient.CheckRedirect,
+}
+
+// notifyJobWebhook POSTs the job outcome to the request's webhook_url. When
+// webhook_secret is set, the raw body is signed with HMAC-SHA256 in
+// X-Timecard-Signature so the receiver can verify it came from us.
+func notifyJobWebhook(ctx context.Context, job GenerateJob, status string) {
+	webhookURL := strings.TrimSpace(job.Request.WebhookURL)
+	// Checked again at delivery: the host may resolve elsewhere by now.
+	if err := isAllowedPhotoURL(webhookURL); err != nil {
+		slog.WarnContext(ctx, "webhook_url not allowed, skipping notification", "job_id", job.ID, "error", err)
+		return
+	}
+	payload := map[string]any{
+		"job_id":        job.ID,
+		"status":        status,
+		"employee_name": job.Request.EmployeeName,
+		"pay_period":    job.Request.PayPeriodNum,
+		"timestamp":     time.Now().UTC().Format(time.RFC3339),
+	}
+	if status == JobStatusDone {
+		// Webhook receivers usually don't hold an API token, so hand them a
+		// signed link when signing is configured.
+		downloadURL := jobDownloadURL(job.ID)
+		if len(downloadSigningSecret) > 0 {
+			downloadURL, _ = signedDownloadURL(job.ID)
+		}
+		payload["download_url"] = downloadURL
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not encode webhook payload", "job_id", job.ID, "error", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		slog.WarnContext(ctx, "could not build webhook request", "job_id", job.ID, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := job.Request.WebhookSecret; secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Timecard-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		slog.WarnContext(ctx, "webhook delivery failed", "job_id", job.ID, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.WarnContext(ctx, "webhook returned non-2xx status", "job_id", job.ID, "status_code", resp.StatusCode)
+		return
+	}
+	slog.InfoContext(ctx, "webhook delivered", "job_id", job.ID, "status_code", resp.StatusCode)
+}
+func evictExpiredJobs(cutoff time.Time) {
+	jobStatuses.Range(func(key, value any) bool {
+		status := value.(*JobStatus)
+		status.mu.Lock()
+		expired := status.CreatedAt.Before(cutoff)
+		status.mu.Unlock()
+		if expired {
+			jobStatuses.Delete(key)
+		}
+		return true
+	})
+}
+
+// createJobHandler handles POST /api/jobs: it queues the timecard and answers 202
+// with the job ID to poll.
+func createJobHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var req TimecardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.WarnContext(ctx, "error decoding request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if errs := validateTimecardRequest(req); len(errs) > 0 {
+		respondValidationErrors(w, r, errs)
+		return
+	}
+	if !checkEmployeePhotoURL(w, r, req) {
+		return
+	}
+	if webhookURL := strings.TrimSpace(req.WebhookURL); webhookURL != "" {
+		if err := isAllowedPhotoURL(webhookURL); err != nil {
+			slog.WarnContext(ctx, "rejected webhook_url", "error", err)
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: fmt.Sprintf("webhook_url: %v", err)})
+			return
+		}
+	}
+	job := GenerateJob{
+		ID:        uuid.New().String(),
+		RequestID: requestIDFromContext(ctx),
+		Tenant:    tenantFromContext(ctx),
+		Request:   req,
+	}
+	jobStatuses.Store(job.ID, &JobStatus{
+		ID:           job.ID,
+		TenantID:     tenantIDFromContext(ctx),
+		Status:       JobStatusPending,
+		EmployeeName: req.EmployeeName,
+		CreatedAt:    time.Now(),
+	})
+	if err := generatePool.Submit(ctx, func() { processGenerateJob(job) }); err != nil {
+		jobStatuses.Delete(job.ID)
+		slog.WarnContext(ctx, "async job not started", "employee_name", req.EmployeeName, "error", err)
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrQueueFull, Message: "All workers are busy, try again later"})
+		return
+	}
+	slog.InfoContext(ctx, "queued async job", "job_id", job.ID, "employee_name", req.EmployeeName)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": job.ID})
+}
+
+// jobStatusHandler handles GET /api/jobs/{id}.
+func jobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, ok := lookupJob(r.Context(), r.PathValue("id"))
+	if !ok {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "Job not found"})
+		return
+	}
+	status.mu.Lock()
+	response := map[string]string{"job_id": status.ID, "status": status.Status}
+	if status.Status == JobStatusDone {
+		response["download_url"] = jobDownloadURL(status.ID)
+	}
+	if status.ErrorMessage != "" {
+		response["error_message"] = status.ErrorMessage
+	}
+	status.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// jobFileHandler handles GET /api/files/{id}/excel for completed jobs.
+func jobFileHandler(w http.ResponseWriter, r *http.Request) {
+	status, ok := lookupJob(r.Context(), r.PathValue("id"))
+	if !ok {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "File not found"})
+		return
+	}
+	serveJobExcel(w, r, status)
+}
+
+// serveJobExcel writes a finished job's workbook, or 409 if it isn't done yet.
+func serveJobExcel(w http.ResponseWriter, r *http.Request, status *JobStatus) {
+	status.mu.Lock()
+	data, employeeName, state := status.ExcelData, status.EmployeeName, status.Status
+	status.mu.Unlock()
+	if state != JobStatusDone {
+		respondError(w, r, http.StatusConflict, APIError{Code: ErrFileNotReady, Message: "File not ready"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", attachmentDisposition("timecard_"+employeeName+".xlsx"))
+	w.Write(data)
+}
+
+// lookupJob returns the job with the given ID if it belongs to the
+// request's tenant.
+func lookupJob(ctx context.Context, id string) (*JobStatus, bool) {
+	status, ok := loadJob(id)
+	if !ok || status.TenantID != tenantIDFromContext(ctx) {
+		return nil, false
+	}
+	return status, true
+}
+
+// loadJob returns the job with the given ID whatever its tenant, for signed
+// downloads, whose token was only issued after a lookupJob.
+func loadJob(id string) (*JobStatus, bool) {
+	if id == "" {
+		return nil, false
+	}
+	value, ok := jobStatuses.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return value.(*JobStatus), true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// initLogging installs a JSON slog handler as the default logger. Output goes to
+// stderr unless LOG_FILE is set; LOG_LEVEL selects debug|info|warn|error (default info).
+func initLogging() {
+	var out io.Writer = os.Stderr
+	var logFileErr, levelErr error
+	if path := strings.TrimSpace(os.Getenv("LOG_FILE")); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			logFileErr = err
+		} else {
+			out = file
+		}
+	}
+	var level slog.Level
+	levelText := strings.TrimSpace(os.Getenv("LOG_LEVEL"))
+	if levelText != "" {
+		levelErr = level.UnmarshalText([]byte(levelText))
+		if levelErr != nil {
+			level = slog.LevelInfo
+		}
+	}
+	handler := slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(requestContextHandler{handler}))
+	if logFileErr != nil {
+		slog.Warn("could not open LOG_FILE, logging to stderr", "error", logFileErr)
+	}
+	if levelErr != nil {
+		slog.Warn("invalid LOG_LEVEL, using info", "value", levelText)
+	}
+}
+
+// requestContextHandler adds the request_id from the context to every record.
+type requestContextHandler struct {
+	slog.Handler
+}
+
+func (h requestContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+func (h requestContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestContextHandler{h.Handler.WithAttrs(attrs)}
+}
+func (h requestContextHandler) WithGroup(name string) slog.Handler {
+	return requestContextHandler{h.Handler.WithGroup(name)}
+}
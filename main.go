@@ -1,274 +1,49 @@
 package main
 
 import (
-	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/xuri/excelize/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2"
+	"golang.org/x/text/unicode/norm"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
-	"io"
-	"log"
+	"log/slog"
 	"math"
+	"net"
 	"net/http"
+	"net/mail"
 	"net/smtp"
+	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
-)
-
-// setCellPreserveStyle writes a value into a cell while preserving the cell's original style (borders, number formats, alignment, etc).
-// This is useful because some Excel clients will "repair" workbooks if the calc chain/style graph is inconsistent,
-// and the repair process can strip formatting. We keep the template style intact by re-applying it after writes.
-func setCellPreserveStyle(f *excelize.File, sheet, cell string, value any) error {
-	styleID, _ := f.GetCellStyle(sheet, cell) // ignore errors; styleID=0 means "no explicit style"
-	if err := f.SetCellValue(sheet, cell, value); err != nil {
-		return err
-	}
-	if styleID != 0 {
-		_ = f.SetCellStyle(sheet, cell, cell, styleID)
-	}
-	return nil
-}
-
-// removeCalcChain removes xl/calcChain.xml if present.
-// Note: In excelize v2.9.0+, calcChain is handled automatically.
-// This function is kept for compatibility but does nothing in newer versions.
-// forceRecalcAndRemoveCalcChain post-processes an XLSX to:
-// 1) remove xl/calcChain.xml (and related references), and
-// 2) ensure Excel recalculates formulas when the file is opened.
-func forceRecalcAndRemoveCalcChain(xlsx []byte) ([]byte, error) {
-	zr, err := zip.NewReader(bytes.NewReader(xlsx), int64(len(xlsx)))
-	if err != nil {
-		return nil, fmt.Errorf("open xlsx zip: %w", err)
-	}
-	var out bytes.Buffer
-	zw := zip.NewWriter(&out)
-	for _, zf := range zr.File {
-		name := zf.Name
-		// Drop calcChain entirely (stale calcChain is the common cause of "formulas show but values don't update")
-		if name == "xl/calcChain.xml" {
-			continue
-		}
-		// For files we need to modify, read into memory
-		needsModification := name == "xl/workbook.xml" || name == "xl/_rels/workbook.xml.rels" || name == "[Content_Types].xml"
-		if needsModification {
-			rc, err := zf.Open()
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("read %s: %w", name, err)
-			}
-			b, err := io.ReadAll(rc)
-			_ = rc.Close()
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("read %s: %w", name, err)
-			}
-			switch name {
-			case "xl/workbook.xml":
-				b = ensureCalcPrAutoFull(b)
-			case "xl/_rels/workbook.xml.rels":
-				b = removeCalcChainRelationships(b)
-			case "[Content_Types].xml":
-				b = removeCalcChainContentType(b)
-			}
-			// Create new header, preserving original compression method
-			hdr := zf.FileHeader
-			// Force Store (no compression) for modified files to avoid recompression issues
-			hdr.Method = zip.Store
-			w, err := zw.CreateHeader(&hdr)
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("write %s: %w", name, err)
-			}
-			if _, err := w.Write(b); err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("write %s: %w", name, err)
-			}
-		} else {
-			// For files we don't modify (like styles.xml), copy raw compressed bytes
-			// This preserves the exact compression and avoids corruption
-			// Use OpenRaw() to get compressed bytes without decompression
-			rc, err := zf.OpenRaw()
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("open raw %s: %w", name, err)
-			}
-			// Get compressed size
-			compressedSize := int64(zf.CompressedSize64)
-			if compressedSize == 0 {
-				compressedSize = int64(zf.CompressedSize)
-			}
-			// Create raw writer to preserve compression
-			hdr := zf.FileHeader
-			w, err := zw.CreateRaw(&hdr)
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("create raw %s: %w", name, err)
-			}
-			// Copy raw compressed bytes
-			// Note: OpenRaw() returns io.Reader (not io.ReadCloser), so no Close() needed
-			if _, err := io.CopyN(w, rc, compressedSize); err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("copy raw %s: %w", name, err)
-			}
-		}
-	}
-	if err := zw.Close(); err != nil {
-		return nil, fmt.Errorf("finalize xlsx zip: %w", err)
-	}
-	return out.Bytes(), nil
-}
-
-// extractStylesXMLFromTemplate extracts the original styles.xml from the template file
-// This preserves the exact formatting that works before excelize potentially corrupts it
-func extractStylesXMLFromTemplate(templatePath string) ([]byte, error) {
-	templateData, err := os.ReadFile(templatePath)
-	if err != nil {
-		return nil, fmt.Errorf("read template: %w", err)
-	}
-	zr, err := zip.NewReader(bytes.NewReader(templateData), int64(len(templateData)))
-	if err != nil {
-		return nil, fmt.Errorf("open template zip: %w", err)
-	}
-	for _, zf := range zr.File {
-		if zf.Name == "xl/styles.xml" {
-			rc, err := zf.Open()
-			if err != nil {
-				return nil, fmt.Errorf("open styles.xml: %w", err)
-			}
-			defer rc.Close()
-			data, err := io.ReadAll(rc)
-			if err != nil {
-				return nil, fmt.Errorf("read styles.xml: %w", err)
-			}
-			return data, nil
-		}
-	}
-	return nil, fmt.Errorf("styles.xml not found in template")
-}
+	"unicode"
 
-// restoreStylesXML replaces the styles.xml in the Excel file with the original from the template
-func restoreStylesXML(excelData []byte, originalStylesXML []byte) ([]byte, error) {
-	zr, err := zip.NewReader(bytes.NewReader(excelData), int64(len(excelData)))
-	if err != nil {
-		return nil, fmt.Errorf("open excel zip: %w", err)
-	}
-	var out bytes.Buffer
-	zw := zip.NewWriter(&out)
-	for _, zf := range zr.File {
-		if zf.Name == "xl/styles.xml" {
-			// Replace with original styles.xml
-			hdr := zf.FileHeader
-			hdr.Method = zip.Store // Use Store (no compression) for XML
-			w, err := zw.CreateHeader(&hdr)
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("create styles.xml: %w", err)
-			}
-			if _, err := w.Write(originalStylesXML); err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("write styles.xml: %w", err)
-			}
-		} else {
-			// Copy all other files as-is using raw copy to preserve compression
-			if zf.Name == "xl/calcChain.xml" {
-				continue // Skip calcChain
-			}
-			// Use raw copy for unmodified files to preserve exact compression
-			rc, err := zf.OpenRaw()
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("open raw %s: %w", zf.Name, err)
-			}
-			compressedSize := int64(zf.CompressedSize64)
-			if compressedSize == 0 {
-				compressedSize = int64(zf.CompressedSize)
-			}
-			hdr := zf.FileHeader
-			w, err := zw.CreateRaw(&hdr)
-			if err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("create raw %s: %w", zf.Name, err)
-			}
-			if _, err := io.CopyN(w, rc, compressedSize); err != nil {
-				_ = zw.Close()
-				return nil, fmt.Errorf("copy raw %s: %w", zf.Name, err)
-			}
-		}
-	}
-	if err := zw.Close(); err != nil {
-		return nil, fmt.Errorf("finalize zip: %w", err)
-	}
-	return out.Bytes(), nil
-}
-func ensureCalcPrAutoFull(b []byte) []byte {
-	s := string(b)
-	// Match calcPr element - handles both:
-	// 1. Self-closing: <calcPr calcId="123"/>
-	// 2. Open/close pair: <calcPr calcId="123"></calcPr>
-	reSelfClosing := regexp.MustCompile(`<calcPr([^>]*)/\s*>`)
-	reOpenClose := regexp.MustCompile(`<calcPr([^>]*)>\s*</calcPr>`)
-	// Try self-closing first
-	if loc := reSelfClosing.FindStringIndex(s); loc != nil {
-		attrs := reSelfClosing.FindStringSubmatch(s)[1]
-		newCalcPr := buildCalcPrElement(attrs)
-		s = s[:loc[0]] + newCalcPr + s[loc[1]:]
-		return []byte(s)
-	}
-	// Try open/close pair
-	if loc := reOpenClose.FindStringIndex(s); loc != nil {
-		attrs := reOpenClose.FindStringSubmatch(s)[1]
-		newCalcPr := buildCalcPrElement(attrs)
-		s = s[:loc[0]] + newCalcPr + s[loc[1]:]
-		return []byte(s)
-	}
-	// No calcPr found -> insert a minimal one before </workbook>
-	insert := `<calcPr calcId="1" calcMode="auto" fullCalcOnLoad="1"/>`
-	if strings.Contains(s, "</workbook>") {
-		s = strings.Replace(s, "</workbook>", insert+"</workbook>", 1)
-		return []byte(s)
-	}
-	return b
-}
-
-// buildCalcPrElement creates a calcPr element with the required attributes
-func buildCalcPrElement(existingAttrs string) string {
-	attrs := existingAttrs
-	// Ensure calcMode="auto"
-	if regexp.MustCompile(`calcMode="[^"]*"`).MatchString(attrs) {
-		attrs = regexp.MustCompile(`calcMode="[^"]*"`).ReplaceAllString(attrs, `calcMode="auto"`)
-	} else {
-		attrs = ` calcMode="auto"` + attrs
-	}
-	// Ensure fullCalcOnLoad="1"
-	if regexp.MustCompile(`fullCalcOnLoad="[^"]*"`).MatchString(attrs) {
-		attrs = regexp.MustCompile(`fullCalcOnLoad="[^"]*"`).ReplaceAllString(attrs, `fullCalcOnLoad="1"`)
-	} else {
-		attrs = ` fullCalcOnLoad="1"` + attrs
-	}
-	return `<calcPr` + attrs + `/>`
-}
-func removeCalcChainRelationships(b []byte) []byte {
-	s := string(b)
-	// Remove any relationship entries that reference calcChain (by Type or Target)
-	re := regexp.MustCompile(`(?s)<Relationship[^>]*(?:calcChain)[^>]*/>`)
-	s = re.ReplaceAllString(s, "")
-	return []byte(s)
-}
-func removeCalcChainContentType(b []byte) []byte {
-	s := string(b)
-	re := regexp.MustCompile(`(?s)<Override[^>]*PartName="/xl/calcChain\.xml"[^>]*/>`)
-	s = re.ReplaceAllString(s, "")
-	return []byte(s)
-}
+	"timecard-api/internal/email"
+	"timecard-api/internal/excel"
+)
 
 // =============================================================================
 // DATA STRUCTURES - Clear naming convention:
@@ -289,6 +64,25 @@ type TimecardRequest struct {
 	OnCallDailyAmount   *float64     `json:"on_call_daily_amount,omitempty"`
 	OnCallPerCallAmount *float64     `json:"on_call_per_call_amount,omitempty"`
 	CompanyLogoBase64   *string      `json:"company_logo_base64,omitempty"`
+	EmployeePhotoURL    string       `json:"employee_photo_url,omitempty"`
+	WebhookURL          string       `json:"webhook_url,omitempty"`
+	WebhookSecret       string       `json:"webhook_secret,omitempty"`
+	// Jurisdiction ("CA-ON", "US", ...) selects the holiday calendar used to
+	// warn about regular hours booked on statutory holidays.
+	Jurisdiction string `json:"jurisdiction,omitempty"`
+	// ScheduleTemplate names a standard week from schedule_templates.json
+	// ("5x8") used to fill in entries when the request sends none.
+	ScheduleTemplate string `json:"schedule_template,omitempty"`
+	// Rounding is applied to each day's hours before they are written.
+	Rounding RoundingConfig `json:"rounding"`
+	// WeekStartDay is "sunday" (the default) or "monday". It decides where
+	// weeks start when week_start_date is not given.
+	WeekStartDay string `json:"week_start_day,omitempty"`
+	// JobColors maps job numbers to an RGB hex fill ("FF6B6B") for their
+	// columns on the week sheets. Jobs not listed keep the template's fill.
+	JobColors map[string]string `json:"job_colors,omitempty"`
+	// ExcelSheetPassword, when set, protects each week sheet against editing.
+	ExcelSheetPassword string `json:"excel_sheet_password,omitempty"`
 }
 
 // Job represents a job/project with its number and display name
@@ -315,6 +109,9 @@ type Entry struct {
 	Hours        float64 `json:"hours"`
 	Overtime     bool    `json:"overtime"`
 	IsNightShift bool    `json:"is_night_shift"`
+	// NightShiftStartHour is the hour (0-23) a night shift began; when set, a
+	// shift running past midnight is split across the two days.
+	NightShiftStartHour int `json:"night_shift_start_hour,omitempty"`
 }
 type WeekData struct {
 	WeekNumber    int     `json:"week_number"`
@@ -328,6 +125,7 @@ type EmailTimecardRequest struct {
 	TimecardRequest
 	To      string  `json:"to"`
 	CC      *string `json:"cc,omitempty"`
+	ReplyTo string  `json:"reply_to,omitempty"`
 	Subject string  `json:"subject"`
 	Body    string  `json:"body"`
 }
@@ -366,34 +164,210 @@ type ExpenseCodeItem struct {
 }
 
 func main() {
+	cfg, cfgErr := loadConfig()
+	initLogging()
+	if cfgErr != nil {
+		slog.Error("could not load config", "error", cfgErr)
+		os.Exit(1)
+	}
+	if errs := validateConfig(cfg); len(errs) > 0 {
+		for _, err := range errs {
+			slog.Error("invalid config", "error", err)
+		}
+		os.Exit(1)
+	}
+	applyConfig(cfg)
+	logEffectiveConfig(cfg)
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 	// Log template info at startup
 	logTemplateInfo()
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/api/generate-timecard", corsMiddleware(generateTimecardHandler))
-	http.HandleFunc("/api/email-timecard", corsMiddleware(emailTimecardHandler))
-	http.HandleFunc("/api/generate-pdf-timecard", corsMiddleware(generatePDFTimecardHandler))
-	http.HandleFunc("/api/generate-expense-mileage", corsMiddleware(generateExpenseMileageHandler))
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatal(err)
+	maxRequestBytes = int64(getEnvInt("MAX_REQUEST_BYTES", int(maxRequestBytes)))
+	loadFeatureFlags()
+	loadPDFConverters()
+	if err := loadAPITokens(); err != nil {
+		slog.Error("could not load auth config", "error", err)
+		os.Exit(1)
+	}
+	loadDownloadSigning()
+	if err := loadSMTPTLSMode(); err != nil {
+		slog.Error("could not load SMTP config", "error", err)
+		os.Exit(1)
+	}
+	loadSMTPSecrets()
+	loadJobList()
+	loadScheduleTemplates()
+	loadHolidays()
+	loadTenants()
+	loadTrustedProxies()
+	initRateLimiter()
+	initWorkerPool()
+	initAsyncJobs()
+	initWorkbookCache()
+	initStorage(context.Background())
+	initFileCleanup()
+	initAuditLog()
+	initTimecardDB()
+	initRedis()
+	initIdempotency()
+	initEmailRecords()
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		slog.Error("could not initialise tracing", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		// Flush spans still in the batcher; the collector may be gone already.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("could not flush traces", "error", err)
+		}
+	}()
+	mux := http.NewServeMux()
+	// apiRoute registers an /api or /admin handler under /v1 behind per-IP rate
+	// limiting, bearer-token auth, tenant lookup and Idempotency-Key replay. The
+	// unversioned path stays as a deprecated alias. A pattern may start with a
+	// method ("GET /api/jobs/{id}"); handlers read wildcards with r.PathValue.
+	apiRoute := func(pattern string, handler http.HandlerFunc) {
+		method, path := splitRoutePattern(pattern)
+		wrapped := chain(handler, rateLimitMiddleware, authMiddleware, tenantMiddleware, idempotencyMiddleware)
+		mux.Handle(method+"/v"+apiVersion+path, wrapped)
+		mux.HandleFunc(method+path, deprecatedAlias(wrapped.ServeHTTP))
+	}
+	// testRoute registers an operator diagnostic under /test with the same
+	// middleware, admin-only and unversioned.
+	testRoute := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, chain(requireAdmin(handler), rateLimitMiddleware, authMiddleware, tenantMiddleware))
+	}
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/healthz/live", livenessHandler)
+	mux.HandleFunc("/healthz/ready", readinessHandler)
+	if strings.EqualFold(os.Getenv("ENABLE_METRICS"), "true") {
+		mux.Handle("/metrics", promhttp.Handler())
+		slog.Info("metrics endpoint enabled", "path", "/metrics")
+	}
+	registerPprof(mux)
+	apiRoute("/api/generate-timecard", withTimeout(generateTimecardHandler, generateTimeout()))
+	apiRoute("/api/email-timecard", requireFeature(&features.EnableEmail, withTimeout(emailTimecardHandler, emailTimeout())))
+	apiRoute("/api/generate-and-email-timecard", requireFeature(&features.EnableEmail, generateAndEmailTimecardHandler))
+	apiRoute("/api/bulk-email", requireFeature(&features.EnableEmail, bulkEmailHandler))
+	apiRoute("GET /api/email-status/{id}", emailStatusHandler)
+	apiRoute("/api/generate-pdf-timecard", generatePDFTimecardHandler)
+	apiRoute("/api/validate-timecard", validateTimecardPreviewHandler)
+	apiRoute("/api/generate-expense-mileage", generateExpenseMileageHandler)
+	apiRoute("GET /api/jobs", listJobsHandler)
+	apiRoute("POST /api/jobs", createJobHandler)
+	apiRoute("GET /api/jobs/{id}", jobStatusHandler)
+	apiRoute("GET /api/jobs/{id}/progress", jobProgressHandler)
+	apiRoute("GET /api/files/{id}/excel", jobFileHandler)
+	apiRoute("POST /api/files/{id}/sign", signFileHandler)
+	apiRoute("/api/batch-generate", requireFeature(&features.EnableBatch, batchGenerateHandler))
+	apiRoute("/api/features", featuresHandler)
+	apiRoute("/api/template-info", requireAdmin(templateInfoHandler))
+	apiRoute("GET /api/status", requireAdmin(statusHandler))
+	apiRoute("/api/import/csv", importCSVHandler)
+	apiRoute("GET /api/pay-periods", payPeriodsHandler)
+	apiRoute("GET /api/pay-periods/current", currentPayPeriodHandler)
+	apiRoute("/api/holidays", holidaysHandler)
+	apiRoute("/api/timecards", timecardsHandler)
+	apiRoute("GET /api/timecards/{id}/ical", timecardICalHandler)
+	apiRoute("POST /api/timecards/{id}/approve", requireAdmin(approveTimecardHandler))
+	apiRoute("POST /api/timecards/{id}/reject", requireAdmin(rejectTimecardHandler))
+	apiRoute("/admin/audit-log", requireAdmin(auditLogHandler))
+	apiRoute("GET /admin/audit-log/verify", requireAdmin(auditVerifyHandler))
+	apiRoute("POST /admin/rotate-credentials", requireAdmin(rotateCredentialsHandler))
+	apiRoute("GET /admin/pool-stats", requireAdmin(poolStatsHandler))
+	apiRoute("POST /admin/jobs", requireAdmin(addServerJobHandler))
+	apiRoute("DELETE /admin/jobs/{job_number}", requireAdmin(deleteServerJobHandler))
+	testRoute("/test/smtp", testSMTPHandler)
+	testRoute("/test/template", testTemplateHandler)
+	// API docs and version info are public so the Swagger UI can fetch the spec
+	// without a token.
+	mux.HandleFunc("/v"+apiVersion+"/api/openapi.yaml", openAPISpecHandler)
+	mux.HandleFunc("/api/openapi.yaml", deprecatedAlias(openAPISpecHandler))
+	mux.HandleFunc("/v"+apiVersion+"/api/docs", apiDocsHandler)
+	mux.HandleFunc("/api/docs", deprecatedAlias(apiDocsHandler))
+	mux.HandleFunc("/api/version", versionHandler)
+	// Signed downloads authenticate with the token in the URL, not a bearer token.
+	download := rateLimitMiddleware(http.HandlerFunc(downloadHandler))
+	mux.Handle("/v"+apiVersion+"/api/download", download)
+	mux.HandleFunc("/api/download", deprecatedAlias(download.ServeHTTP))
+	srv := &http.Server{
+		Addr: ":" + port,
+		// CORS wraps the whole mux so preflight OPTIONS requests are answered
+		// before method-specific routes can turn them away.
+		Handler:   chain(mux, requestIDMiddleware, recoverMiddleware, loggingMiddleware, corsMiddleware),
+		ConnState: trackConnState,
+	}
+	// SIGHUP reloads file-backed configuration without a restart.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			slog.Info("SIGHUP received, reloading configuration")
+			loadJobList()
+			loadScheduleTemplates()
+			resetTemplateCache()
+			workbookCache.Purge()
+			logTemplateInfo()
+		}
+	}()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	go func() {
+		slog.Info("server starting", "port", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+	serverReady.Store(true)
+	<-ctx.Done()
+	stop()
+	slog.Info("shutdown signal received, draining connections", "active_connections", activeConns.Load())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.Warn("drain deadline reached", "active_connections", activeConns.Load())
+		} else {
+			slog.Warn("shutdown error", "error", err)
+		}
+		return
+	}
+	// Async jobs outlive their requests; let the running ones finish.
+	slog.Info("waiting for running jobs", "in_flight", generatePool.Stats().InFlight)
+	generatePool.Drain()
+	slog.Info("server stopped")
+}
+
+// activeConns counts connections that are currently open (new, active or idle).
+var activeConns atomic.Int64
+
+func trackConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		activeConns.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		activeConns.Add(-1)
 	}
 }
 func logTemplateInfo() {
-	templatePath := "template.xlsx"
-	data, err := os.ReadFile(templatePath)
+	templatePath := templateFile("template.xlsx")
+	data, err := readTemplate(templatePath)
 	if err != nil {
-		log.Printf("TEMPLATE startup: ERROR reading template: %v", err)
+		slog.Error("template startup: could not read template", "path", templatePath, "error", err)
 		return
 	}
 	hash := sha256.Sum256(data)
 	hashStr := fmt.Sprintf("%x", hash)
-	f, err := excelize.OpenFile(templatePath)
+	templateSHA256.Store(hashStr)
+	f, err := excelize.OpenReader(bytes.NewReader(data))
 	if err != nil {
-		log.Printf("TEMPLATE startup: ERROR opening template: %v", err)
+		slog.Error("template startup: could not open template", "path", templatePath, "error", err)
 		return
 	}
 	defer f.Close()
@@ -410,97 +384,143 @@ func logTemplateInfo() {
 	if commit == "" {
 		commit = "unknown"
 	}
-	log.Printf("TEMPLATE startup: OK path=%s size=%d sha256=%s sheets=%v markers=%v commit=%s",
-		templatePath, len(data), hashStr, sheets, markers, commit)
-}
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		next(w, r)
-	}
+	slog.Info("template startup: OK",
+		"path", templatePath,
+		"size", len(data),
+		"sha256", hashStr,
+		"sheets", sheets,
+		"markers", markers,
+		"commit", commit,
+	)
+	templateLoaded.Store(true)
 }
 func generateTimecardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "generate_timecard", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	r = r.WithContext(ctx)
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
 		return
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
 	var req TimecardRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		slog.WarnContext(ctx, "error decoding request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if errs := validateTimecardRequest(req); len(errs) > 0 {
+		respondValidationErrors(w, r, errs)
 		return
 	}
-	log.Printf("Generating timecard for %s", req.EmployeeName)
+	if !checkEmployeePhotoURL(w, r, req) {
+		return
+	}
+	start := time.Now()
+	slog.InfoContext(ctx, "generating timecard",
+		"employee_name", req.EmployeeName,
+		"pay_period", req.PayPeriodNum,
+		"jobs", len(req.Jobs),
+		"entries", len(req.Entries),
+	)
 	// Debug: Log received data
-	log.Printf("=== REQUEST DEBUG ===")
-	log.Printf("Jobs received: %d", len(req.Jobs))
 	for _, j := range req.Jobs {
-		log.Printf("  Job: jobNumber='%s', jobName='%s'", j.JobNumber, j.JobName)
+		slog.DebugContext(ctx, "request job", "job_number", j.JobNumber, "job_name", j.JobName)
 	}
-	log.Printf("Entries received: %d", len(req.Entries))
 	for _, e := range req.Entries {
-		log.Printf("  Entry: date=%s, jobNumber='%s', labourCode='%s', hours=%.1f, overtime=%v, night=%v",
-			e.Date, e.JobNumber, e.LabourCode, e.Hours, e.Overtime, e.IsNightShift)
+		slog.DebugContext(ctx, "request entry",
+			"date", e.Date,
+			"job_number", e.JobNumber,
+			"labour_code", e.LabourCode,
+			"hours", e.Hours,
+			"overtime", e.Overtime,
+			"night", e.IsNightShift,
+		)
 	}
-	log.Printf("On-Call Daily Amount: $%.2f, Per-Call Amount: $%.2f",
-		getOnCallDailyAmount(req), getOnCallPerCallAmount(req))
-	log.Printf("===================")
-	excelData, err := generateExcelFile(req)
-	if err != nil {
-		log.Printf("Error generating Excel: %v", err)
-		http.Error(w, fmt.Sprintf("Error generating timecard: %v", err), http.StatusInternalServerError)
+	slog.DebugContext(ctx, "on-call amounts",
+		"daily", getOnCallDailyAmount(req),
+		"per_call", getOnCallPerCallAmount(req),
+	)
+	// Approved timecards are immutable, so when approval can't be checked
+	// nothing is generated rather than risk overwriting one.
+	if approvedAt, err := timecardApproval(ctx, req); err != nil {
+		slog.ErrorContext(ctx, "could not check timecard approval", "employee_name", req.EmployeeName, "error", err)
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrUnavailable, Message: "Could not check whether the timecard is approved"})
+		return
+	} else if approvedAt != nil {
+		approvedAt := approvedAt.UTC()
+		respondError(w, r, http.StatusConflict, APIError{
+			Code:       ErrTimecardApproved,
+			Message:    "Timecard has already been approved",
+			ApprovedAt: &approvedAt,
+		})
 		return
 	}
-	// Post-process: remove calcChain.xml and force Excel to recalculate on open
-	excelData, err = forceRecalcAndRemoveCalcChain(excelData)
+	setHoursSummaryHeaders(w, req)
+	etag, err := timecardETag(tenantFromContext(ctx), req)
 	if err != nil {
-		log.Printf("Warning: Could not post-process Excel file: %v", err)
-		// Continue anyway - the file should still be usable
-	} else {
-		log.Printf("Post-processed Excel: removed calcChain, added fullCalcOnLoad")
+		slog.WarnContext(ctx, "could not compute ETag", "error", err)
+	}
+	auditID := auditStart(r, AuditActionGenerate, req)
+	if etag != "" {
+		if fileKey, result := serveCachedTimecard(w, r, etag, req); result != cacheMiss {
+			auditFinish(ctx, auditID, nil)
+			// A 304 sends nothing new, so it is not a new revision.
+			if result == cacheHit {
+				recordTimecard(ctx, req, fileKey)
+			}
+			return
+		}
 	}
-	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"timecard_%s.xlsx\"", req.EmployeeName))
-	w.WriteHeader(http.StatusOK)
-	w.Write(excelData)
-	log.Printf("Successfully generated timecard (%d bytes)", len(excelData))
+	excelData, err := buildTimecardWorkbookShared(ctx, etag, req)
+	auditFinish(ctx, auditID, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating Excel", "employee_name", req.EmployeeName, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrGenerationFailed, Message: fmt.Sprintf("Error generating timecard: %v", err)})
+		return
+	}
+	if etag != "" {
+		workbookCache.Add(etag, excelData)
+		w.Header().Set("ETag", etag)
+	}
+	fileKey := writeTimecardFile(w, r, req, excelData, "xlsx", xlsxContentType)
+	recordTimecard(ctx, req, fileKey)
+	slog.InfoContext(ctx, "generated timecard",
+		"employee_name", req.EmployeeName,
+		"pay_period", req.PayPeriodNum,
+		"bytes", len(excelData),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
 }
 func generateExpenseMileageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
 		return
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
 	var req ExpenseMileageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding expense/mileage request: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		slog.WarnContext(ctx, "error decoding expense/mileage request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
 		return
 	}
-	log.Printf(
-		"Generating expense/mileage workbook for %s (expenses=%d mileage=%d)",
-		req.EmployeeName,
-		len(req.Expenses),
-		len(req.Mileage),
+	start := time.Now()
+	slog.InfoContext(ctx, "generating expense/mileage workbook",
+		"employee_name", req.EmployeeName,
+		"expenses", len(req.Expenses),
+		"mileage", len(req.Mileage),
 	)
-	workbookData, err := generateExpenseMileageExcelFile(req)
+	workbookData, err := generateExpenseMileageExcelFile(ctx, req)
 	if err != nil {
-		log.Printf("Error generating expense/mileage workbook: %v", err)
-		http.Error(w, fmt.Sprintf("Error generating workbook: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "error generating expense/mileage workbook", "employee_name", req.EmployeeName, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrGenerationFailed, Message: fmt.Sprintf("Error generating workbook: %v", err)})
 		return
 	}
-	workbookData, err = forceRecalcAndRemoveCalcChain(workbookData)
+	workbookData, err = excel.ForceRecalc(workbookData)
 	if err != nil {
-		log.Printf("Warning: Could not post-process expense/mileage workbook: %v", err)
+		slog.WarnContext(ctx, "could not post-process expense/mileage workbook", "error", err)
 	}
 	fileNameEmployee := strings.ReplaceAll(strings.TrimSpace(req.EmployeeName), " ", "_")
 	if fileNameEmployee == "" {
@@ -509,74 +529,305 @@ func generateExpenseMileageHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	w.Header().Set(
 		"Content-Disposition",
-		fmt.Sprintf("attachment; filename=\"expense_mileage_%s_%s.xlsx\"", fileNameEmployee, time.Now().Format("2006-01-02")),
+		attachmentDisposition(fmt.Sprintf("expense_mileage_%s_%s.xlsx", fileNameEmployee, time.Now().Format("2006-01-02"))),
 	)
 	w.WriteHeader(http.StatusOK)
 	w.Write(workbookData)
-	log.Printf("Successfully generated expense/mileage workbook (%d bytes)", len(workbookData))
+	slog.InfoContext(ctx, "generated expense/mileage workbook",
+		"employee_name", req.EmployeeName,
+		"bytes", len(workbookData),
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
 }
 func emailTimecardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
 		return
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
 	var req EmailTimecardRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		slog.WarnContext(ctx, "error decoding request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
 		return
 	}
-	log.Printf("Emailing timecard for %s to %s", req.EmployeeName, req.To)
-	excelData, err := generateExcelFile(req.TimecardRequest)
-	if err != nil {
-		log.Printf("Error generating Excel: %v", err)
-		http.Error(w, fmt.Sprintf("Error generating timecard: %v", err), http.StatusInternalServerError)
+	if errs := validateTimecardRequest(req.TimecardRequest); len(errs) > 0 {
+		respondValidationErrors(w, r, errs)
 		return
 	}
-	// Post-process: remove calcChain.xml and force Excel to recalculate on open
-	excelData, err = forceRecalcAndRemoveCalcChain(excelData)
+	if !checkEmployeePhotoURL(w, r, req.TimecardRequest) {
+		return
+	}
+	record := newEmailRecord(ctx, req.To, req.Subject)
+	start := time.Now()
+	slog.InfoContext(ctx, "emailing timecard",
+		"employee_name", req.EmployeeName,
+		"pay_period", req.PayPeriodNum,
+		"to", req.To,
+		"email_id", record.ID,
+	)
+	auditID := auditStart(r, AuditActionEmail, req.TimecardRequest)
+	excelData, err := buildTimecardWorkbook(ctx, req.TimecardRequest)
 	if err != nil {
-		log.Printf("Warning: Could not post-process Excel file for email: %v", err)
-		// Continue anyway
-	} else {
-		log.Printf("Post-processed Excel for email: removed calcChain, added fullCalcOnLoad")
+		slog.ErrorContext(ctx, "error generating Excel", "employee_name", req.EmployeeName, "error", err)
+		record.markFailed(err)
+		auditFinish(ctx, auditID, err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrGenerationFailed, Message: fmt.Sprintf("Error generating timecard: %v", err)})
+		return
 	}
-	err = sendEmail(req.To, req.CC, req.Subject, req.Body, excelData, req.EmployeeName)
+	err = sendEmail(ctx, tenantFromContext(ctx), req.To, req.CC, req.ReplyTo, req.Subject, req.Body, excelData, req.EmployeeName)
+	recordEmail(err)
+	auditFinish(ctx, auditID, err)
 	if err != nil {
-		log.Printf("Error sending email: %v", err)
-		http.Error(w, fmt.Sprintf("Error sending email: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "error sending email", "email_id", record.ID, "error", err)
+		record.markFailed(err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrEmailFailed, Message: fmt.Sprintf("Error sending email: %v", err)})
 		return
 	}
+	record.markSent()
+	slog.InfoContext(ctx, "emailed timecard",
+		"employee_name", req.EmployeeName,
+		"email_id", record.ID,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
 	response := map[string]string{
-		"status":  "success",
-		"message": fmt.Sprintf("Email sent to %s", req.To),
+		"status":   EmailStatusSent,
+		"email_id": record.ID,
+		"message":  fmt.Sprintf("Email sent to %s", req.To),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// Email delivery states tracked in EmailRecord.Status.
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed"
+)
+
+// EmailRecord tracks the delivery state of one email-timecard request so clients can
+// poll /api/email-status/{id} after the fact.
+type EmailRecord struct {
+	mu        sync.Mutex
+	ID        string     `json:"id"`
+	To        string     `json:"to"`
+	Subject   string     `json:"subject"`
+	Status    string     `json:"status"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	tenantID  string
+	createdAt time.Time
+}
+
+var (
+	emailRecords   sync.Map // email ID -> *EmailRecord
+	emailRecordTTL = time.Hour
+)
+
+// newEmailRecord stores a pending record for a message about to be sent,
+// visible only to the request's tenant.
+func newEmailRecord(ctx context.Context, to, subject string) *EmailRecord {
+	record := &EmailRecord{
+		ID:        uuid.New().String(),
+		To:        to,
+		Subject:   subject,
+		Status:    EmailStatusPending,
+		tenantID:  tenantIDFromContext(ctx),
+		createdAt: time.Now(),
+	}
+	emailRecords.Store(record.ID, record)
+	return record
+}
+
+// initEmailRecords starts a sweeper that drops email records older than
+// EMAIL_RECORD_TTL_MINUTES (default 60), after which
+// /api/email-status/{id} answers 404.
+func initEmailRecords() {
+	if ttl := getEnvInt("EMAIL_RECORD_TTL_MINUTES", 60); ttl > 0 {
+		emailRecordTTL = time.Duration(ttl) * time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			evictExpiredEmailRecords(time.Now().Add(-emailRecordTTL))
+		}
+	}()
+}
+
+func evictExpiredEmailRecords(cutoff time.Time) {
+	emailRecords.Range(func(key, value any) bool {
+		if value.(*EmailRecord).createdAt.Before(cutoff) {
+			emailRecords.Delete(key)
+		}
+		return true
+	})
+}
+
+func (rec *EmailRecord) markSent() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.Status = EmailStatusSent
+	sentAt := time.Now().UTC()
+	rec.SentAt = &sentAt
+	rec.Error = ""
+}
+func (rec *EmailRecord) markFailed(err error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.Status = EmailStatusFailed
+	rec.Error = err.Error()
+}
+func emailStatusHandler(w http.ResponseWriter, r *http.Request) {
+	value, ok := emailRecords.Load(r.PathValue("id"))
+	if !ok || value.(*EmailRecord).tenantID != tenantIDFromContext(r.Context()) {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "Email not found"})
+		return
+	}
+	record := value.(*EmailRecord)
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
 func generatePDFTimecardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
 		return
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
 	var req TimecardRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		slog.WarnContext(ctx, "error decoding request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if errs := validateTimecardRequest(req); len(errs) > 0 {
+		respondValidationErrors(w, r, errs)
 		return
 	}
-	log.Printf("Generating PDF timecard for %s", req.EmployeeName)
-	pdfData, err := generatePDFFile(req)
+	if !checkEmployeePhotoURL(w, r, req) {
+		return
+	}
+	if !features.EnablePDF {
+		// PDF output is switched off: hand back the workbook instead.
+		slog.InfoContext(ctx, "PDF disabled, returning Excel", "employee_name", req.EmployeeName)
+		excelData, err := buildTimecardWorkbook(ctx, req)
+		if err != nil {
+			slog.ErrorContext(ctx, "error generating Excel", "employee_name", req.EmployeeName, "error", err)
+			respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrGenerationFailed, Message: fmt.Sprintf("Error generating timecard: %v", err)})
+			return
+		}
+		writeTimecardFile(w, r, req, excelData, "xlsx", xlsxContentType)
+		return
+	}
+	slog.InfoContext(ctx, "generating PDF timecard", "employee_name", req.EmployeeName, "pay_period", req.PayPeriodNum)
+	auditID := auditStart(r, AuditActionGeneratePDF, req)
+	pdfData, err := generatePDFFile(ctx, req)
+	auditFinish(ctx, auditID, err)
 	if err != nil {
-		log.Printf("Error generating PDF: %v", err)
-		http.Error(w, fmt.Sprintf("Error generating PDF timecard: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "error generating PDF", "employee_name", req.EmployeeName, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrPDFFailed, Message: fmt.Sprintf("Error generating PDF timecard: %v", err)})
 		return
 	}
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"timecard_%s.pdf\"", req.EmployeeName))
-	w.WriteHeader(http.StatusOK)
-	w.Write(pdfData)
-	log.Printf("Successfully generated PDF timecard (%d bytes)", len(pdfData))
+	writeTimecardFile(w, r, req, pdfData, "pdf", pdfContentType)
+	slog.InfoContext(ctx, "generated PDF timecard", "employee_name", req.EmployeeName, "bytes", len(pdfData))
+}
+
+// generatePDFFile builds the timecard workbook and converts it to PDF.
+func generatePDFFile(ctx context.Context, req TimecardRequest) ([]byte, error) {
+	excelData, err := buildTimecardWorkbook(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return convertExcelToPDF(ctx, excelData)
+}
+
+// maxRequestBytes caps JSON request bodies (MAX_REQUEST_BYTES, default 10 MB).
+var maxRequestBytes int64 = 10_485_760
+
+// decodeErrorStatus maps a JSON decode error to a response status: 413 when the body
+// hit the MaxBytesReader limit, 400 otherwise.
+func decodeErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// attachmentDisposition builds a Content-Disposition header that survives
+// non-ASCII names: an ASCII approximation in filename= for older clients, and
+// the exact UTF-8 name in RFC 5987 filename*= for everything else.
+func attachmentDisposition(filename string) string {
+	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s",
+		asciiFilename(filename), url.PathEscape(filename))
+}
+
+// asciiFilename strips accents ("José" -> "Jose") and replaces anything that
+// still isn't printable ASCII, plus quotes and backslashes, with '_'.
+func asciiFilename(name string) string {
+	decomposed := norm.NFD.String(name)
+	var b strings.Builder
+	for _, r := range decomposed {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r < 0x20 || r > 0x7e || r == '"' || r == '\\':
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// unsafeFilenameChars are path separators and the characters Windows forbids
+// in file names.
+var unsafeFilenameChars = strings.NewReplacer(" ", "_", "/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "<", "_", ">", "_", "|", "_", "..", "_")
+
+// sanitizeFilename turns an employee name into something safe to use as one
+// file name or path segment: ASCII only, no separators or ".." and no leading
+// dot. An empty result becomes "employee".
+func sanitizeFilename(name string) string {
+	name = unsafeFilenameChars.Replace(strings.TrimSpace(asciiFilename(name)))
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "employee"
+	}
+	return name
+}
+
+// buildTimecardWorkbook generates the timecard workbook and post-processes it so
+// Excel recalculates formulas on open. It records generation metrics.
+func buildTimecardWorkbook(ctx context.Context, req TimecardRequest) ([]byte, error) {
+	tenant := tenantFromContext(ctx)
+	if len(req.Jobs) == 0 && tenant != nil {
+		req.Jobs = tenant.Jobs
+	}
+	if len(req.Jobs) == 0 {
+		req.Jobs = defaultJobs()
+	}
+	timer := prometheus.NewTimer(generateDuration)
+	excelData, err := generateExcelFile(ctx, tenant, req)
+	timer.ObserveDuration()
+	recordGenerate(err)
+	if err != nil {
+		return nil, err
+	}
+	// Post-process: remove calcChain.xml and force Excel to recalculate on open
+	reportProgress(ctx, ProgressFinalizing, 90)
+	processed, err := excel.ForceRecalc(excelData)
+	if err != nil {
+		slog.WarnContext(ctx, "could not post-process Excel file", "error", err)
+		// Continue anyway - the file should still be usable
+		return excelData, nil
+	}
+	slog.DebugContext(ctx, "post-processed Excel: removed calcChain, added fullCalcOnLoad")
+	return processed, nil
 }
 func getOnCallDailyAmount(req TimecardRequest) float64 {
 	if req.OnCallDailyAmount != nil {
@@ -590,18 +841,24 @@ func getOnCallPerCallAmount(req TimecardRequest) float64 {
 	}
 	return 50.0
 }
-func generateExcelFile(req TimecardRequest) ([]byte, error) {
-	templatePath := "template.xlsx"
+func generateExcelFile(ctx context.Context, tenant *TenantConfig, req TimecardRequest) (_ []byte, err error) {
+	ctx, span := tracer.Start(ctx, "create_xlsx")
+	defer func() { endSpan(span, err) }()
+	templateData, err := readTemplate(tenant.timecardTemplatePath())
+	if err != nil {
+		slog.WarnContext(ctx, "template not found, creating basic file", "error", err)
+		return generateBasicExcelFile(req)
+	}
 	// Extract original styles.xml from template BEFORE excelize modifies it
 	// This preserves the exact formatting that works
-	originalStylesXML, err := extractStylesXMLFromTemplate(templatePath)
+	originalStylesXML, err := excel.StylesXML(templateData)
 	if err != nil {
-		log.Printf("Warning: Could not extract styles.xml from template: %v (continuing anyway)", err)
+		slog.WarnContext(ctx, "could not extract styles.xml from template, continuing anyway", "error", err)
 		originalStylesXML = nil
 	}
-	f, err := excelize.OpenFile(templatePath)
+	f, err := excelize.OpenReader(bytes.NewReader(templateData))
 	if err != nil {
-		log.Printf("Warning: Template not found, creating basic file: %v", err)
+		slog.WarnContext(ctx, "template not found, creating basic file", "error", err)
 		return generateBasicExcelFile(req)
 	}
 	defer f.Close()
@@ -610,46 +867,7 @@ func generateExcelFile(req TimecardRequest) ([]byte, error) {
 	for _, job := range req.Jobs {
 		jobNameMap[job.JobNumber] = job.JobName
 	}
-	// If Weeks isn't provided, build Week 1/Week 2 from Entries
-	if len(req.Weeks) == 0 && len(req.Entries) > 0 {
-		var week1Start time.Time
-		var parseErr error
-		if req.WeekStartDate != "" {
-			week1Start, parseErr = time.Parse(time.RFC3339, req.WeekStartDate)
-		}
-		if parseErr != nil || req.WeekStartDate == "" {
-			earliest := time.Now().UTC()
-			for _, e := range req.Entries {
-				if t, err := time.Parse(time.RFC3339, e.Date); err == nil {
-					if t.Before(earliest) {
-						earliest = t
-					}
-				}
-			}
-			wd := int(earliest.Weekday())
-			week1Start = time.Date(earliest.Year(), earliest.Month(), earliest.Day()-wd, 0, 0, 0, 0, time.UTC)
-		}
-		week2Start := week1Start.AddDate(0, 0, 7)
-		w1 := WeekData{WeekNumber: 1, WeekStartDate: week1Start.Format(time.RFC3339), WeekLabel: "Week 1"}
-		w2 := WeekData{WeekNumber: 2, WeekStartDate: week2Start.Format(time.RFC3339), WeekLabel: "Week 2"}
-		for _, e := range req.Entries {
-			t, err := time.Parse(time.RFC3339, e.Date)
-			if err != nil {
-				continue
-			}
-			if !t.Before(week2Start) {
-				w2.Entries = append(w2.Entries, e)
-			} else {
-				w1.Entries = append(w1.Entries, e)
-			}
-		}
-		if len(w1.Entries) > 0 {
-			req.Weeks = append(req.Weeks, w1)
-		}
-		if len(w2.Entries) > 0 {
-			req.Weeks = append(req.Weeks, w2)
-		}
-	}
+	req.Weeks = timecardWeeks(req)
 	sheets := f.GetSheetList()
 	if len(sheets) == 0 {
 		return nil, fmt.Errorf("no sheets found in template")
@@ -674,45 +892,51 @@ func generateExcelFile(req TimecardRequest) ([]byte, error) {
 					6,   // vertical offset in px
 				)
 				if err != nil {
-					log.Printf("Warning: Could not insert timecard logo on sheet %s: %v", sheetName, err)
+					slog.WarnContext(ctx, "could not insert timecard logo", "sheet", sheetName, "error", err)
 					continue
 				}
 				insertedCount++
 			}
 			if insertedCount == 0 {
-				log.Printf("Warning: Timecard logo provided but could not be inserted on any sheet")
+				slog.WarnContext(ctx, "timecard logo provided but could not be inserted on any sheet")
 			} else {
-				log.Printf("Inserted custom timecard logo on %d sheet(s)", insertedCount)
+				slog.DebugContext(ctx, "inserted custom timecard logo", "sheets", insertedCount)
 			}
 		}
 	}
-	log.Printf("Template has %d sheets: %v", len(sheets), sheets)
+	if req.EmployeePhotoURL != "" && sheetLayout.EmployeePhotoCell != "" {
+		insertEmployeePhoto(ctx, f, req, sheets)
+	}
+	slog.DebugContext(ctx, "template sheets", "count", len(sheets), "sheets", sheets)
 	resolvedSheetForWeek := make(map[int]string)
 	entriesForWeek := make(map[int][]Entry)
-	for _, weekData := range req.Weeks {
-		sheetIndex := weekData.WeekNumber - 1
-		if sheetIndex < 0 || sheetIndex >= len(sheets) {
-			log.Printf("Warning: Week %d requested but only %d sheets available, using sheet 0",
-				weekData.WeekNumber, len(sheets))
-			sheetIndex = 0
+	for i, weekData := range req.Weeks {
+		// Stop if the client went away or the job was cancelled.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		reportProgress(ctx, ProgressGenerating, 80*i/len(req.Weeks))
+		sheetName, ok := weekSheetName(sheets, weekData.WeekNumber)
+		if !ok {
+			slog.WarnContext(ctx, "week has no matching sheet, using sheet 0",
+				"week_number", weekData.WeekNumber, "sheets", len(sheets))
 		}
-		sheetName := sheets[sheetIndex]
 		resolvedSheetForWeek[weekData.WeekNumber] = sheetName
 		entriesForWeek[weekData.WeekNumber] = append([]Entry{}, weekData.Entries...)
 		// Log marker cells before filling
 		a3Before, _ := f.GetCellValue(sheetName, "A3")
 		ad3Before, _ := f.GetCellValue(sheetName, "AD3")
-		log.Printf("MARKER BEFORE fill: sheet=%s A3=%q AD3=%q", sheetName, a3Before, ad3Before)
-		log.Printf("Filling sheet '%s' with Week %d data (%d entries)",
-			sheetName, weekData.WeekNumber, len(weekData.Entries))
-		err = fillWeekSheet(f, sheetName, req, weekData, weekData.WeekNumber, jobNameMap)
+		slog.DebugContext(ctx, "marker before fill", "sheet", sheetName, "A3", a3Before, "AD3", ad3Before)
+		slog.DebugContext(ctx, "filling sheet",
+			"sheet", sheetName, "week_number", weekData.WeekNumber, "entries", len(weekData.Entries))
+		err = fillWeekSheet(ctx, f, sheetName, req, weekData, weekData.WeekNumber, jobNameMap)
 		if err != nil {
-			log.Printf("Error filling Week %d: %v", weekData.WeekNumber, err)
+			slog.ErrorContext(ctx, "error filling week", "week_number", weekData.WeekNumber, "error", err)
 		}
 		// Log marker cells after filling
 		a3After, _ := f.GetCellValue(sheetName, "A3")
 		ad3After, _ := f.GetCellValue(sheetName, "AD3")
-		log.Printf("MARKER AFTER fill: sheet=%s A3=%q AD3=%q", sheetName, a3After, ad3After)
+		slog.DebugContext(ctx, "marker after fill", "sheet", sheetName, "A3", a3After, "AD3", ad3After)
 	}
 	// Stabilize final-week Summary Totals values by writing the merged values directly
 	// from Week 1 + Week 2 source summary rows. This avoids stale cross-sheet formula
@@ -735,6 +959,26 @@ func generateExcelFile(req TimecardRequest) ([]byte, error) {
 			getOnCallPerCallAmount(req),
 		)
 	}
+	if err := addSummarySheet(f, req, sheetLayout); err != nil {
+		slog.WarnContext(ctx, "could not add summary sheet", "error", err)
+	}
+	if req.ExcelSheetPassword != "" {
+		protected := make(map[string]bool)
+		for _, sheetName := range resolvedSheetForWeek {
+			if protected[sheetName] {
+				continue
+			}
+			protected[sheetName] = true
+			if err := f.ProtectSheet(sheetName, &excelize.SheetProtectionOptions{
+				AlgorithmName:       "SHA-512",
+				Password:            req.ExcelSheetPassword,
+				SelectLockedCells:   true,
+				SelectUnlockedCells: true,
+			}); err != nil {
+				return nil, fmt.Errorf("protecting sheet %s: %w", sheetName, err)
+			}
+		}
+	}
 	buffer, err := f.WriteToBuffer()
 	if err != nil {
 		return nil, err
@@ -743,17 +987,133 @@ func generateExcelFile(req TimecardRequest) ([]byte, error) {
 	// excelize may rewrite styles.xml incorrectly, so we replace it with the original
 	if originalStylesXML != nil {
 		excelData := buffer.Bytes()
-		restoredData, err := restoreStylesXML(excelData, originalStylesXML)
+		restoredData, err := excel.RestoreStylesXML(excelData, originalStylesXML)
 		if err != nil {
-			log.Printf("Warning: Could not restore styles.xml: %v (using excelize output)", err)
+			slog.WarnContext(ctx, "could not restore styles.xml, using excelize output", "error", err)
 			return excelData, nil
 		}
-		log.Printf("Restored original styles.xml to preserve formatting")
+		slog.DebugContext(ctx, "restored original styles.xml to preserve formatting")
 		return restoredData, nil
 	}
 	return buffer.Bytes(), nil
 }
 
+// weekSheetName returns the template sheet for a week number, falling back
+// to the first sheet (ok=false) when the template has no such sheet.
+func weekSheetName(sheets []string, weekNumber int) (string, bool) {
+	if weekNumber < 1 || weekNumber > len(sheets) {
+		return sheets[0], false
+	}
+	return sheets[weekNumber-1], true
+}
+
+// summarySheetName is the tab added by addSummarySheet.
+const summarySheetName = "Summary"
+
+// addSummarySheet adds a "Summary" tab with one row per job whose regular,
+// night and overtime hours are SUM formulas over the column totals of each
+// week sheet, followed by pay period totals. It becomes the active sheet.
+// The values are written unstyled. Styles added here would survive the
+// styles.xml restore, since excel.RestoreStylesXML keeps appended styles.
+func addSummarySheet(f *excelize.File, req TimecardRequest, layout SheetLayout) error {
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 || len(req.Weeks) == 0 {
+		return nil
+	}
+	type jobRefs struct {
+		regular, night, overtime []string
+	}
+	refs := make(map[string]*jobRefs)
+	jobOrder := make([]string, 0, len(req.Jobs))
+	jobFor := func(jobNumber string) *jobRefs {
+		if refs[jobNumber] == nil {
+			refs[jobNumber] = &jobRefs{}
+			jobOrder = append(jobOrder, jobNumber)
+		}
+		return refs[jobNumber]
+	}
+	jobNames := make(map[string]string)
+	for _, job := range req.Jobs {
+		jobNumber := strings.TrimSpace(job.JobNumber)
+		jobNames[jobNumber] = job.JobName
+		jobFor(jobNumber)
+	}
+	for _, weekData := range req.Weeks {
+		sheetName, _ := weekSheetName(sheets, weekData.WeekNumber)
+		quoted := "'" + strings.ReplaceAll(sheetName, "'", "''") + "'!"
+		for _, section := range layout.sections() {
+			totalRow := section.TotalRow
+			for i, colKey := range getSectionColumns(weekData.Entries, layout, section.Name) {
+				if i >= len(labourCodeColumns) {
+					break
+				}
+				jobNumber, _, _ := splitColumnKey(colKey)
+				job := jobFor(jobNumber)
+				ref := func(row int) string {
+					return fmt.Sprintf("%s%s%d", quoted, labourCodeColumns[i], row)
+				}
+				switch section.Name {
+				case sectionRegular:
+					job.regular = append(job.regular, ref(totalRow))
+					job.night = append(job.night, ref(totalRow+1))
+				case sectionNight:
+					job.night = append(job.night, ref(totalRow))
+				case sectionOvertime:
+					job.overtime = append(job.overtime, ref(totalRow))
+				}
+			}
+		}
+	}
+	index, err := f.NewSheet(summarySheetName)
+	if err != nil {
+		return err
+	}
+	for i, header := range []string{"Job Number", "Job Name", "Regular", "Night", "Overtime", "Total"} {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		if err := f.SetCellValue(summarySheetName, cell, header); err != nil {
+			return err
+		}
+	}
+	sumOf := func(cells []string) string {
+		if len(cells) == 0 {
+			return "0"
+		}
+		return "SUM(" + strings.Join(cells, ",") + ")"
+	}
+	row := 2
+	for _, jobNumber := range jobOrder {
+		job := refs[jobNumber]
+		_ = f.SetCellValue(summarySheetName, fmt.Sprintf("A%d", row), excel.SanitizeInput(jobNumber))
+		_ = f.SetCellValue(summarySheetName, fmt.Sprintf("B%d", row), excel.SanitizeInput(jobNames[jobNumber]))
+		_ = f.SetCellFormula(summarySheetName, fmt.Sprintf("C%d", row), sumOf(job.regular))
+		_ = f.SetCellFormula(summarySheetName, fmt.Sprintf("D%d", row), sumOf(job.night))
+		_ = f.SetCellFormula(summarySheetName, fmt.Sprintf("E%d", row), sumOf(job.overtime))
+		_ = f.SetCellFormula(summarySheetName, fmt.Sprintf("F%d", row), fmt.Sprintf("SUM(C%d:E%d)", row, row))
+		row++
+	}
+	lastJobRow := row - 1
+	row++
+	for _, total := range []struct {
+		label string
+		col   string
+	}{
+		{"Total Regular", "C"},
+		{"Total Night", "D"},
+		{"Total Overtime", "E"},
+		{"Total Hours", "F"},
+	} {
+		_ = f.SetCellValue(summarySheetName, fmt.Sprintf("A%d", row), total.label)
+		formula := "0"
+		if lastJobRow >= 2 {
+			formula = fmt.Sprintf("SUM(%s2:%s%d)", total.col, total.col, lastJobRow)
+		}
+		_ = f.SetCellFormula(summarySheetName, fmt.Sprintf("%s%d", total.col, row), formula)
+		row++
+	}
+	f.SetActiveSheet(index)
+	return nil
+}
+
 type weekSummaryTotals struct {
 	OT         float64
 	DT         float64
@@ -788,10 +1148,10 @@ func applyFinalSummaryTotals(
 	writeSummaryValue := func(row int, value float64, blankWhenZero bool) {
 		cell := fmt.Sprintf("AK%d", row)
 		if blankWhenZero && math.Abs(value) < 0.0000001 {
-			_ = setCellPreserveStyle(f, week2Sheet, cell, "")
+			_ = excel.SetCellPreserveStyle(f, week2Sheet, cell, "")
 			return
 		}
-		_ = setCellPreserveStyle(f, week2Sheet, cell, value)
+		_ = excel.SetCellPreserveStyle(f, week2Sheet, cell, value)
 	}
 	// Summary Totals table (Week 2 sheet):
 	// AJ19 OT, AJ20 DT, AJ21 VP, AJ22 NS, AJ23 STAT, AJ24 On Call, AJ25 # of On Call
@@ -881,7 +1241,7 @@ func insertLogoIntoExcel(f *excelize.File, logoBase64 string) (string, error) {
 			OffsetY: 10,
 		})
 		if err != nil {
-			log.Printf("Warning: Could not add logo to sheet %s: %v", sheetName, err)
+			slog.Warn("could not add logo to sheet", "sheet", sheetName, "error", err)
 			// If we can't add to any sheet, return error to skip logo entirely
 			if insertedCount == 0 {
 				return tmpFileName, fmt.Errorf("failed to insert logo into any sheet: %w", err)
@@ -889,7 +1249,7 @@ func insertLogoIntoExcel(f *excelize.File, logoBase64 string) (string, error) {
 			continue
 		}
 		insertedCount++
-		log.Printf("Logo inserted into sheet %s", sheetName)
+		slog.Debug("logo inserted into sheet", "sheet", sheetName)
 	}
 	if insertedCount == 0 {
 		return tmpFileName, fmt.Errorf("logo insertion failed for all sheets")
@@ -1010,146 +1370,411 @@ func clearTemplateHeaderLogoPictures(f *excelize.File, sheetName string) {
 		}
 	}
 }
-func fillWeekSheet(f *excelize.File, sheetName string, req TimecardRequest, weekData WeekData, weekNum int, jobNameMap map[string]string) error {
+
+// timecardWeeks returns req.Weeks or, when the client sent a flat entry list,
+// splits Entries into Week 1 and Week 2 starting at week_start_date (or the
+// Sunday on or before the earliest entry).
+func timecardWeeks(req TimecardRequest) []WeekData {
+	expandScheduleTemplate(&req)
+	if len(req.Weeks) > 0 {
+		return splitMidnightWeeks(req.Weeks)
+	}
+	if len(req.Entries) == 0 {
+		return nil
+	}
+	req.Entries = splitMidnightEntries(req.Entries)
+	var week1Start time.Time
+	var parseErr error
+	if req.WeekStartDate != "" {
+		week1Start, parseErr = time.Parse(time.RFC3339, req.WeekStartDate)
+	}
+	if parseErr != nil || req.WeekStartDate == "" {
+		earliest := time.Now().UTC()
+		for _, e := range req.Entries {
+			if t, err := time.Parse(time.RFC3339, e.Date); err == nil {
+				if t.Before(earliest) {
+					earliest = t
+				}
+			}
+		}
+		wd := (int(earliest.Weekday()) - int(weekStartDay(req)) + 7) % 7
+		week1Start = time.Date(earliest.Year(), earliest.Month(), earliest.Day()-wd, 0, 0, 0, 0, time.UTC)
+	}
+	week2Start := week1Start.AddDate(0, 0, 7)
+	w1 := WeekData{WeekNumber: 1, WeekStartDate: week1Start.Format(time.RFC3339), WeekLabel: "Week 1"}
+	w2 := WeekData{WeekNumber: 2, WeekStartDate: week2Start.Format(time.RFC3339), WeekLabel: "Week 2"}
+	for _, e := range req.Entries {
+		t, err := time.Parse(time.RFC3339, e.Date)
+		if err != nil {
+			continue
+		}
+		if !t.Before(week2Start) {
+			w2.Entries = append(w2.Entries, e)
+		} else {
+			w1.Entries = append(w1.Entries, e)
+		}
+	}
+	var weeks []WeekData
+	if len(w1.Entries) > 0 {
+		weeks = append(weeks, w1)
+	}
+	if len(w2.Entries) > 0 {
+		weeks = append(weeks, w2)
+	}
+	return weeks
+}
+
+// templateDayLabels are the weekday names template.xlsx prints beside each
+// day row, indexed by time.Weekday.
+var templateDayLabels = [7]string{"Sun", "Mon", "Tues", "Wed", "Thurs", "Fri", "Sat"}
+
+// writeDayLabels relabels the day rows of every section, and the "Date
+// Start" header, for a week that does not start on Sunday. The template
+// prints Sunday-first labels, so they are left alone otherwise.
+func writeDayLabels(f *excelize.File, sheetName string, weekStart time.Time, sections []sheetSection) {
+	if weekStart.Weekday() == time.Sunday {
+		return
+	}
+	header := fmt.Sprintf("A%d", sheetLayout.RegularHeaderRow)
+	_ = excel.SetCellPreserveStyle(f, sheetName, header, templateDayLabels[weekStart.Weekday()]+" Date Start:")
+	for _, section := range sections {
+		for dayOffset := 0; dayOffset < 7; dayOffset++ {
+			day := weekStart.AddDate(0, 0, dayOffset).Weekday()
+			_ = excel.SetCellPreserveStyle(f, sheetName, fmt.Sprintf("A%d", section.StartRow+dayOffset), templateDayLabels[day])
+		}
+	}
+}
+
+// weekStartDay is the weekday a request's weeks start on.
+func weekStartDay(req TimecardRequest) time.Weekday {
+	if strings.EqualFold(req.WeekStartDay, "monday") {
+		return time.Monday
+	}
+	return time.Sunday
+}
+
+// splitMidnightEntry splits a night shift that runs past midnight: the first
+// entry keeps the hours up to midnight on the original date and the second
+// has the rest on the next day. Entries without NightShiftStartHour, or that
+// end by midnight, come back unchanged with ok false.
+func splitMidnightEntry(e Entry) (first, second Entry, ok bool) {
+	if !e.IsNightShift || e.NightShiftStartHour <= 0 || e.NightShiftStartHour > 23 || float64(e.NightShiftStartHour)+e.Hours <= 24 {
+		return e, Entry{}, false
+	}
+	date, err := time.Parse(time.RFC3339, e.Date)
+	if err != nil {
+		return e, Entry{}, false
+	}
+	first, second = e, e
+	first.Hours = float64(24 - e.NightShiftStartHour)
+	second.Hours = e.Hours - first.Hours
+	second.Date = date.AddDate(0, 0, 1).Format(time.RFC3339)
+	second.NightShiftStartHour = 0
+	return first, second, true
+}
+
+// splitMidnightEntries applies splitMidnightEntry to every entry.
+func splitMidnightEntries(entries []Entry) []Entry {
+	out := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		first, second, ok := splitMidnightEntry(e)
+		out = append(out, first)
+		if ok {
+			out = append(out, second)
+		}
+	}
+	return out
+}
+
+// splitMidnightWeeks splits midnight-spanning entries in explicit weeks. A
+// second half that falls past the end of its week moves to the week that
+// covers its date; validateTimecardRequest rejects one that no week covers.
+func splitMidnightWeeks(weeks []WeekData) []WeekData {
+	out := make([]WeekData, len(weeks))
+	starts := make([]time.Time, len(weeks))
+	for i, week := range weeks {
+		out[i] = week
+		out[i].Entries = nil
+		starts[i], _ = time.Parse(time.RFC3339, week.WeekStartDate)
+	}
+	for i, week := range weeks {
+		for _, e := range week.Entries {
+			first, second, ok := splitMidnightEntry(e)
+			out[i].Entries = append(out[i].Entries, first)
+			if !ok {
+				continue
+			}
+			target := i
+			if date, err := time.Parse(time.RFC3339, second.Date); err == nil && !starts[i].IsZero() && !date.Before(starts[i].AddDate(0, 0, 7)) {
+				if j := weekIndex(starts, date); j >= 0 {
+					target = j
+				}
+			}
+			out[target].Entries = append(out[target].Entries, second)
+		}
+	}
+	return out
+}
+
+// weekIndex returns the index of the week in starts whose seven days cover
+// date, or -1. Zero starts are skipped.
+func weekIndex(starts []time.Time, date time.Time) int {
+	for i, start := range starts {
+		if !start.IsZero() && !date.Before(start) && date.Before(start.AddDate(0, 0, 7)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func fillWeekSheet(ctx context.Context, f *excelize.File, sheetName string, req TimecardRequest, weekData WeekData, weekNum int, jobNameMap map[string]string) (err error) {
+	ctx, span := tracer.Start(ctx, "populate_sheet", trace.WithAttributes(attribute.Int("week_number", weekNum)))
+	defer func() { endSpan(span, err) }()
 	weekStart, err := time.Parse(time.RFC3339, weekData.WeekStartDate)
 	if err != nil {
 		return fmt.Errorf("error parsing week start date: %v", err)
 	}
-	log.Printf("=== Filling Week %d ===", weekNum)
-	log.Printf("Week start: %s, Entries: %d", weekStart.Format("2006-01-02"), len(weekData.Entries))
+	slog.DebugContext(ctx, "filling week",
+		"week_number", weekNum,
+		"week_start", weekStart.Format("2006-01-02"),
+		"entries", len(weekData.Entries),
+	)
 	// Header info
-	_ = setCellPreserveStyle(f, sheetName, "M2", req.EmployeeName)
-	_ = setCellPreserveStyle(f, sheetName, "AJ2", req.PayPeriodNum)
-	_ = setCellPreserveStyle(f, sheetName, "AJ3", req.Year)
-	excelDate := timeToExcelDate(weekStart)
-	_ = setCellPreserveStyle(f, sheetName, "B4", excelDate)
-	_ = setCellPreserveStyle(f, sheetName, "AJ4", weekData.WeekLabel)
+	_ = excel.SetCellPreserveStyle(f, sheetName, "M2", excel.SanitizeInput(req.EmployeeName))
+	_ = excel.SetCellPreserveStyle(f, sheetName, "AJ2", req.PayPeriodNum)
+	_ = excel.SetCellPreserveStyle(f, sheetName, "AJ3", req.Year)
+	excelDate := excel.DateSerial(weekStart)
+	_ = excel.SetNumberPreserveStyle(f, sheetName, "B4", excelDate, excel.DateNumFmt)
+	_ = excel.SetCellPreserveStyle(f, sheetName, "AJ4", excel.SanitizeInput(weekData.WeekLabel))
 	// Write On Call rate cells used by template formulas
 	// AM12 = Daily On Call rate, AM13 = Per Call rate
 	onCallDailyAmount := getOnCallDailyAmount(req)
 	onCallPerCallAmount := getOnCallPerCallAmount(req)
-	_ = setCellPreserveStyle(f, sheetName, "AM12", onCallDailyAmount)
-	_ = setCellPreserveStyle(f, sheetName, "AM13", onCallPerCallAmount)
-	log.Printf("  On Call rates written: AM12=$%.2f (daily), AM13=$%.2f (perCall)",
-		onCallDailyAmount, onCallPerCallAmount)
-	// Column layout for the timecard template:
-	// Labour code columns: C, E, G, I, K, M, O, Q, S, U, W, Y, AA, AC, AE, AG
-	// Job number columns:  D, F, H, J, L, N, P, R, T, V, X, Z, AB, AD, AF, AH
-	labourCodeColumns := []string{"C", "E", "G", "I", "K", "M", "O", "Q", "S", "U", "W", "Y", "AA", "AC", "AE", "AG"}
-	jobNumberColumns := []string{"D", "F", "H", "J", "L", "N", "P", "R", "T", "V", "X", "Z", "AB", "AD", "AF", "AH"}
-	// Get unique column keys for regular and overtime entries
-	// Column key format: "jobNumber|labourCode|isNight"
-	regularCols := getUniqueColumnsForType(weekData.Entries, false)
-	overtimeCols := getUniqueColumnsForType(weekData.Entries, true)
-	log.Printf("Regular columns: %v", regularCols)
-	log.Printf("Overtime columns: %v", overtimeCols)
-	// Fill Regular headers (Row 4)
-	for i, colKey := range regularCols {
-		if i >= len(labourCodeColumns) {
-			log.Printf("Warning: More regular columns than available (%d), truncating", len(labourCodeColumns))
-			break
-		}
-		jobNumber, labourCode, isNight := splitColumnKey(colKey)
-		// Prepend "N" to labour code for night shift entries
-		labourCodeToWrite := labourCode
-		if isNight && labourCodeToWrite != "" {
-			labourCodeToWrite = "N" + labourCodeToWrite
-		}
-		// Write labour code to column C, E, G, etc. (row 4)
-		_ = setCellPreserveStyle(f, sheetName, labourCodeColumns[i]+"4", labourCodeToWrite)
-		// Write job number to column D, F, H, etc. (row 4)
-		_ = setCellPreserveStyle(f, sheetName, jobNumberColumns[i]+"4", jobNumber)
-		log.Printf("  REG header col %d: labourCode='%s' -> %s4, jobNumber='%s' -> %s4",
-			i, labourCodeToWrite, labourCodeColumns[i], jobNumber, jobNumberColumns[i])
-	}
-	// Fill Overtime headers (Row 15)
-	for i, colKey := range overtimeCols {
-		if i >= len(labourCodeColumns) {
-			log.Printf("Warning: More overtime columns than available (%d), truncating", len(labourCodeColumns))
-			break
+	_ = excel.SetCellPreserveStyle(f, sheetName, "AM12", onCallDailyAmount)
+	_ = excel.SetCellPreserveStyle(f, sheetName, "AM13", onCallPerCallAmount)
+	slog.DebugContext(ctx, "on-call rates written", "AM12_daily", onCallDailyAmount, "AM13_per_call", onCallPerCallAmount)
+	// Each section gets its own columns, keyed "jobNumber|labourCode|isNight"
+	sections := sheetLayout.sections()
+	writeDayLabels(f, sheetName, weekStart, sections)
+	sectionCols := make(map[string][]string, len(sections))
+	for _, section := range sections {
+		cols := getSectionColumns(weekData.Entries, sheetLayout, section.Name)
+		sectionCols[section.Name] = cols
+		slog.DebugContext(ctx, "week columns", "section", section.Name, "columns", cols)
+		// Labour codes go in C, E, G, etc. and job numbers in D, F, H, etc.
+		for i, colKey := range cols {
+			if i >= len(labourCodeColumns) {
+				slog.WarnContext(ctx, "more columns than available, truncating", "section", section.Name, "available", len(labourCodeColumns))
+				break
+			}
+			jobNumber, labourCode, isNight := splitColumnKey(colKey)
+			// Prepend "N" to labour code for night shift entries
+			labourCodeToWrite := labourCode
+			if isNight && labourCodeToWrite != "" {
+				labourCodeToWrite = "N" + labourCodeToWrite
+			}
+			labourCell := fmt.Sprintf("%s%d", labourCodeColumns[i], section.HeaderRow)
+			jobCell := fmt.Sprintf("%s%d", jobNumberColumns[i], section.HeaderRow)
+			_ = excel.SetCellPreserveStyle(f, sheetName, labourCell, excel.SanitizeInput(labourCodeToWrite))
+			_ = excel.SetCellPreserveStyle(f, sheetName, jobCell, excel.SanitizeInput(jobNumber))
+			if color, ok := jobColor(req, jobNumber); ok {
+				for row := section.StartRow; row <= section.EndRow(); row++ {
+					for _, col := range []string{labourCodeColumns[i], jobNumberColumns[i]} {
+						if err := excel.SetFillPreserveStyle(f, sheetName, fmt.Sprintf("%s%d", col, row), color); err != nil {
+							slog.WarnContext(ctx, "could not color job column", "job_number", jobNumber, "error", err)
+						}
+					}
+				}
+			}
+			slog.DebugContext(ctx, "section header",
+				"section", section.Name, "col", i,
+				"labour_code", labourCodeToWrite, "labour_cell", labourCell,
+				"job_number", jobNumber, "job_cell", jobCell,
+			)
 		}
-		jobNumber, labourCode, isNight := splitColumnKey(colKey)
-		labourCodeToWrite := labourCode
-		if isNight && labourCodeToWrite != "" {
-			labourCodeToWrite = "N" + labourCodeToWrite
-		}
-		// Write labour code to column C, E, G, etc. (row 15)
-		_ = setCellPreserveStyle(f, sheetName, labourCodeColumns[i]+"15", labourCodeToWrite)
-		// Write job number to column D, F, H, etc. (row 15)
-		_ = setCellPreserveStyle(f, sheetName, jobNumberColumns[i]+"15", jobNumber)
-		log.Printf("  OT header col %d: labourCode='%s' -> %s15, jobNumber='%s' -> %s15",
-			i, labourCodeToWrite, labourCodeColumns[i], jobNumber, jobNumberColumns[i])
-	}
-	// Organize entries by date and column key
-	// Map: dateKey -> columnKey -> hours
-	regularTimeEntries := make(map[string]map[string]float64)
-	overtimeEntries := make(map[string]map[string]float64)
+	}
+	// Organize entries by section, date and column key
+	sectionHours := make(map[string]map[string]map[string]float64, len(sections))
 	for _, entry := range weekData.Entries {
 		entryDate, err := time.Parse(time.RFC3339, entry.Date)
 		if err != nil {
-			log.Printf("Warning: Could not parse entry date '%s': %v", entry.Date, err)
+			slog.WarnContext(ctx, "could not parse entry date", "date", entry.Date, "error", err)
 			continue
 		}
 		dateKey := entryDate.Format("2006-01-02")
 		colKey := columnKey(entry)
-		log.Printf("  Processing entry: date=%s, jobNumber='%s', labourCode='%s', hours=%.2f, OT=%v, night=%v => key='%s'",
-			dateKey, entry.JobNumber, entry.LabourCode, entry.Hours, entry.Overtime, entry.IsNightShift, colKey)
-		if entry.Overtime {
-			if overtimeEntries[dateKey] == nil {
-				overtimeEntries[dateKey] = make(map[string]float64)
-			}
-			overtimeEntries[dateKey][colKey] += entry.Hours
-		} else {
-			if regularTimeEntries[dateKey] == nil {
-				regularTimeEntries[dateKey] = make(map[string]float64)
-			}
-			regularTimeEntries[dateKey][colKey] += entry.Hours
+		section := sheetLayout.sectionOf(entry)
+		slog.DebugContext(ctx, "processing entry",
+			"date", dateKey,
+			"job_number", entry.JobNumber,
+			"labour_code", entry.LabourCode,
+			"hours", entry.Hours,
+			"section", section,
+			"key", colKey,
+		)
+		if sectionHours[section] == nil {
+			sectionHours[section] = make(map[string]map[string]float64)
 		}
+		if sectionHours[section][dateKey] == nil {
+			sectionHours[section][dateKey] = make(map[string]float64)
+		}
+		sectionHours[section][dateKey][colKey] += entry.Hours
 	}
-	// Fill each day (7 days in a week)
+	// Fill each day (7 days in a week) of each section
 	for dayOffset := 0; dayOffset < 7; dayOffset++ {
 		currentDate := weekStart.AddDate(0, 0, dayOffset)
 		dateKey := currentDate.Format("2006-01-02")
-		excelDateSerial := timeToExcelDate(currentDate)
-		// Regular time row: 5-11 (dayOffset 0-6)
-		// Overtime row: 16-22 (dayOffset 0-6)
-		regularRow := 5 + dayOffset
-		overtimeRow := 16 + dayOffset
-		// Write dates to column B
-		_ = setCellPreserveStyle(f, sheetName, fmt.Sprintf("B%d", regularRow), excelDateSerial)
-		_ = setCellPreserveStyle(f, sheetName, fmt.Sprintf("B%d", overtimeRow), excelDateSerial)
-		// Fill regular time hours
-		if regularHours, exists := regularTimeEntries[dateKey]; exists {
-			for i, colKey := range regularCols {
+		excelDateSerial := excel.DateSerial(currentDate)
+		for _, section := range sections {
+			row := section.StartRow + dayOffset
+			_ = excel.SetNumberPreserveStyle(f, sheetName, fmt.Sprintf("B%d", row), excelDateSerial, excel.DateNumFmt)
+			dayHours := sectionHours[section.Name][dateKey]
+			for i, colKey := range sectionCols[section.Name] {
 				if i >= len(jobNumberColumns) {
 					break
 				}
-				if hours, ok := regularHours[colKey]; ok && hours > 0 {
+				if hours, ok := dayHours[colKey]; ok && hours > 0 {
+					hours = roundHours(hours, req.Rounding)
 					// Hours go in the job number column (D, F, H, etc.)
-					cellRef := fmt.Sprintf("%s%d", jobNumberColumns[i], regularRow)
-					_ = setCellPreserveStyle(f, sheetName, cellRef, hours)
-					log.Printf("    REG: Wrote %.2f hours to %s (date=%s, key=%s)", hours, cellRef, dateKey, colKey)
+					cellRef := fmt.Sprintf("%s%d", jobNumberColumns[i], row)
+					_ = excel.SetNumberPreserveStyle(f, sheetName, cellRef, hours, excel.HoursNumFmt)
+					slog.DebugContext(ctx, "wrote hours", "section", section.Name, "hours", hours, "cell", cellRef, "date", dateKey, "key", colKey)
 				}
 			}
 		}
-		// Fill overtime hours
-		if otHours, exists := overtimeEntries[dateKey]; exists {
-			for i, colKey := range overtimeCols {
-				if i >= len(jobNumberColumns) {
-					break
-				}
-				if hours, ok := otHours[colKey]; ok && hours > 0 {
-					cellRef := fmt.Sprintf("%s%d", jobNumberColumns[i], overtimeRow)
-					_ = setCellPreserveStyle(f, sheetName, cellRef, hours)
-					log.Printf("    OT: Wrote %.2f hours to %s (date=%s, key=%s)", hours, cellRef, dateKey, colKey)
-				}
-			}
+	}
+	for _, section := range sections {
+		if err := setSectionTotals(f, sheetName, section); err != nil {
+			slog.WarnContext(ctx, "could not write section totals", "sheet", sheetName, "section", section.Name, "error", err)
+		}
+	}
+	if err := applyPrintSetup(f, sheetName, sheetLayout); err != nil {
+		slog.WarnContext(ctx, "could not apply print setup", "sheet", sheetName, "error", err)
+	}
+	if err := applyHeaderFooter(f, sheetName, req); err != nil {
+		slog.WarnContext(ctx, "could not set header/footer", "sheet", sheetName, "error", err)
+	}
+	slog.DebugContext(ctx, "week completed", "week_number", weekNum)
+	return nil
+}
+
+// setSectionTotals gives every column pair of a section a SUM of its day rows
+// in the total row, so totals follow edits made after download. Total cells
+// that already hold a formula are left alone: template.xlsx's own totals also
+// split out night labour codes.
+func setSectionTotals(f *excelize.File, sheetName string, section sheetSection) error {
+	for i, labourCol := range labourCodeColumns {
+		cell := fmt.Sprintf("%s%d", labourCol, section.TotalRow)
+		formula, err := f.GetCellFormula(sheetName, cell)
+		if err != nil {
+			return err
+		}
+		if formula != "" {
+			continue
+		}
+		sum := fmt.Sprintf("SUM(%s%d:%s%d)", labourCol, section.StartRow, jobNumberColumns[i], section.EndRow())
+		if err := f.SetCellFormula(sheetName, cell, sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPrintSetup sets the page layout, print area and frozen header rows of
+// a week sheet from the configured SheetLayout.
+func applyPrintSetup(f *excelize.File, sheetName string, layout SheetLayout) error {
+	orientation := layout.Orientation
+	paperSize := layout.PaperSize
+	if err := f.SetPageLayout(sheetName, &excelize.PageLayoutOptions{
+		Orientation: &orientation,
+		Size:        &paperSize,
+	}); err != nil {
+		return err
+	}
+	area := layout.PrintArea
+	if area == "" {
+		dimension, err := f.GetSheetDimension(sheetName)
+		if err != nil {
+			return err
 		}
+		area = dimension
+	}
+	if err := setSheetPrintArea(f, sheetName, area); err != nil {
+		return err
+	}
+	if layout.FreezeRow > 0 {
+		topLeft, _ := excelize.CoordinatesToCellName(1, layout.FreezeRow+1)
+		return f.SetPanes(sheetName, &excelize.Panes{
+			Freeze:      true,
+			YSplit:      layout.FreezeRow,
+			TopLeftCell: topLeft,
+			ActivePane:  "bottomLeft",
+		})
 	}
-	log.Printf("=== Week %d completed ===", weekNum)
 	return nil
 }
 
+// Printed header and page-number footer for week sheets. The header is
+// rendered with the TimecardRequest.
+var (
+	printHeaderTemplate = template.Must(template.New("header").Parse("&L&B{{.EmployeeName}}&C Pay Period {{.PayPeriodNum}} – {{.Year}}"))
+	printFooter         = "&R Page &P of &N"
+)
+
+// applyHeaderFooter sets the printed header and adds page numbers to the
+// template's footer, keeping the template's own footer text on the left.
+func applyHeaderFooter(f *excelize.File, sheetName string, req TimecardRequest) error {
+	// "&" starts a control code in header/footer text.
+	req.EmployeeName = strings.ReplaceAll(req.EmployeeName, "&", "&&")
+	var header strings.Builder
+	if err := printHeaderTemplate.Execute(&header, req); err != nil {
+		return err
+	}
+	opts, err := f.GetHeaderFooter(sheetName)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		opts = &excelize.HeaderFooterOptions{}
+	}
+	opts.OddHeader = header.String()
+	if !strings.Contains(opts.OddFooter, printFooter) {
+		opts.OddFooter += printFooter
+	}
+	if err := f.SetHeaderFooter(sheetName, opts); err != nil {
+		// Too long with the template's text; keep just the page numbers.
+		opts.OddFooter = printFooter
+		return f.SetHeaderFooter(sheetName, opts)
+	}
+	return nil
+}
+
+// absoluteRange turns "A1:AL30" into "$A$1:$AL$30".
+func absoluteRange(area string) (string, error) {
+	parts := strings.Split(area, ":")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid range %q", area)
+	}
+	for i, cell := range parts {
+		col, row, err := excelize.CellNameToCoordinates(cell)
+		if err != nil {
+			return "", err
+		}
+		if parts[i], err = excelize.CoordinatesToCellName(col, row, true); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// Column layout for the timecard template:
+// Labour code columns: C, E, G, I, K, M, O, Q, S, U, W, Y, AA, AC, AE, AG
+// Job number columns:  D, F, H, J, L, N, P, R, T, V, X, Z, AB, AD, AF, AH
+var (
+	labourCodeColumns = []string{"C", "E", "G", "I", "K", "M", "O", "Q", "S", "U", "W", "Y", "AA", "AC", "AE", "AG"}
+	jobNumberColumns  = []string{"D", "F", "H", "J", "L", "N", "P", "R", "T", "V", "X", "Z", "AB", "AD", "AF", "AH"}
+)
+
 // columnKey creates a unique key for grouping entries by job+labour+night
 // Format: "jobNumber|labourCode|night" where night is "1" or "0"
 func columnKey(e Entry) string {
@@ -1181,12 +1806,22 @@ func splitColumnKey(k string) (string, string, bool) {
 	return jobNumber, labourCode, isNight
 }
 
-// getUniqueColumnsForType returns unique column keys for either regular or overtime entries
-func getUniqueColumnsForType(entries []Entry, isOvertime bool) []string {
+// jobColor returns the fill requested for a job's columns, without any "#".
+func jobColor(req TimecardRequest, jobNumber string) (string, bool) {
+	color, ok := req.JobColors[jobNumber]
+	if !ok {
+		return "", false
+	}
+	return strings.ToUpper(strings.TrimPrefix(color, "#")), true
+}
+
+// getSectionColumns returns the unique column keys of the entries written to
+// the named section of layout.
+func getSectionColumns(entries []Entry, layout SheetLayout, section string) []string {
 	seen := make(map[string]bool)
 	var result []string
 	for _, entry := range entries {
-		if entry.Overtime != isOvertime {
+		if layout.sectionOf(entry) != section {
 			continue
 		}
 		k := columnKey(entry)
@@ -1197,23 +1832,18 @@ func getUniqueColumnsForType(entries []Entry, isOvertime bool) []string {
 	}
 	return result
 }
-func timeToExcelDate(t time.Time) float64 {
-	excelEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
-	duration := t.Sub(excelEpoch)
-	return duration.Hours() / 24.0
-}
 func generateBasicExcelFile(req TimecardRequest) ([]byte, error) {
 	f := excelize.NewFile()
 	defer f.Close()
 	sheet := "Sheet1"
 	f.SetCellValue(sheet, "A1", "Employee Name:")
-	f.SetCellValue(sheet, "B1", req.EmployeeName)
+	f.SetCellValue(sheet, "B1", excel.SanitizeInput(req.EmployeeName))
 	f.SetCellValue(sheet, "A2", "Pay Period:")
 	f.SetCellValue(sheet, "B2", req.PayPeriodNum)
 	f.SetCellValue(sheet, "A3", "Year:")
 	f.SetCellValue(sheet, "B3", req.Year)
 	f.SetCellValue(sheet, "A4", "Week:")
-	f.SetCellValue(sheet, "B4", req.WeekNumberLabel)
+	f.SetCellValue(sheet, "B4", excel.SanitizeInput(req.WeekNumberLabel))
 	f.SetCellValue(sheet, "A6", "Date")
 	f.SetCellValue(sheet, "B6", "Job Number")
 	f.SetCellValue(sheet, "C6", "Labour Code")
@@ -1235,8 +1865,8 @@ func generateBasicExcelFile(req TimecardRequest) ([]byte, error) {
 			continue
 		}
 		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), t.Format("2006-01-02"))
-		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), entry.JobNumber)
-		f.SetCellValue(sheet, fmt.Sprintf("C%d", row), entry.LabourCode)
+		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), excel.SanitizeInput(entry.JobNumber))
+		f.SetCellValue(sheet, fmt.Sprintf("C%d", row), excel.SanitizeInput(entry.LabourCode))
 		f.SetCellValue(sheet, fmt.Sprintf("D%d", row), entry.Hours)
 		overtimeStr := "No"
 		if entry.Overtime {
@@ -1279,14 +1909,17 @@ func generateBasicExcelFile(req TimecardRequest) ([]byte, error) {
 	}
 	return buffer.Bytes(), nil
 }
-func generateExpenseMileageExcelFile(req ExpenseMileageRequest) ([]byte, error) {
-	templatePath := "expense_mileage_template.xlsx"
-	originalStylesXML, err := extractStylesXMLFromTemplate(templatePath)
+func generateExpenseMileageExcelFile(ctx context.Context, req ExpenseMileageRequest) ([]byte, error) {
+	templateData, err := readTemplate(templateFile("expense_mileage_template.xlsx"))
+	if err != nil {
+		return nil, fmt.Errorf("read expense template: %w", err)
+	}
+	originalStylesXML, err := excel.StylesXML(templateData)
 	if err != nil {
-		log.Printf("Warning: Could not extract styles.xml from expense template: %v (continuing anyway)", err)
+		slog.WarnContext(ctx, "could not extract styles.xml from expense template, continuing anyway", "error", err)
 		originalStylesXML = nil
 	}
-	f, err := excelize.OpenFile(templatePath)
+	f, err := excelize.OpenReader(bytes.NewReader(templateData))
 	if err != nil {
 		return nil, fmt.Errorf("open expense template: %w", err)
 	}
@@ -1313,7 +1946,7 @@ func generateExpenseMileageExcelFile(req ExpenseMileageRequest) ([]byte, error)
 	if monthLabel == "" {
 		monthLabel = time.Now().Format("2006-01-02")
 	}
-	employeeName := strings.TrimSpace(req.EmployeeName)
+	employeeName := excel.SanitizeInput(strings.TrimSpace(req.EmployeeName))
 	if employeeName == "" {
 		employeeName = "YOUR NAME"
 	}
@@ -1332,18 +1965,18 @@ func generateExpenseMileageExcelFile(req ExpenseMileageRequest) ([]byte, error)
 				0,
 			)
 			if logoErr != nil {
-				log.Printf("Warning: Could not insert expense logo: %v", logoErr)
+				slog.WarnContext(ctx, "could not insert expense logo", "error", logoErr)
 			}
 		}
 	}
 	// Header values
 	setDateCellWithFallback(f, expenseSheet, "C6", submittalDateText)
-	_ = setCellPreserveStyle(f, expenseSheet, "H6", employeeName)
+	_ = excel.SetCellPreserveStyle(f, expenseSheet, "H6", employeeName)
 	// The mileage template's B1 cell contains a formula link by default.
 	// Overwrite it with plain text to prevent Excel warning markers.
-	_ = setCellPreserveStyle(f, mileageSheet, "B1", employeeName)
+	_ = excel.SetCellPreserveStyle(f, mileageSheet, "B1", employeeName)
 	ensureExpenseHeaderRow(f, expenseSheet)
-	_ = setCellPreserveStyle(f, mileageSheet, "E1", monthLabel)
+	_ = excel.SetCellPreserveStyle(f, mileageSheet, "E1", monthLabel)
 	mileageFooterRow := detectMileageFooterRow(f, mileageSheet)
 	mileageEndRow := mileageFooterRow - 1
 	if mileageEndRow < 8 {
@@ -1364,7 +1997,7 @@ func generateExpenseMileageExcelFile(req ExpenseMileageRequest) ([]byte, error)
 		expenseCodeLines = append(expenseCodeLines, fmt.Sprintf("%s - %s", name, code))
 	}
 	if len(expenseCodeLines) > 0 {
-		_ = setCellPreserveStyle(f, expenseSheet, "A45", strings.Join(expenseCodeLines, "\n"))
+		_ = excel.SetCellPreserveStyle(f, expenseSheet, "A45", strings.Join(expenseCodeLines, "\n"))
 	}
 	applyExpenseSubmissionEmail(f, expenseSheet, req.SubmissionEmail)
 	// Expense data rows
@@ -1373,7 +2006,7 @@ func generateExpenseMileageExcelFile(req ExpenseMileageRequest) ([]byte, error)
 	for row := expenseStartRow; row <= expenseEndRow; row++ {
 		for _, col := range []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J"} {
 			cell := fmt.Sprintf("%s%d", col, row)
-			_ = setCellPreserveStyle(f, expenseSheet, cell, "")
+			_ = excel.SetCellPreserveStyle(f, expenseSheet, cell, "")
 		}
 	}
 	groupedExpenses := groupExpenseItemsByMaterialCode(req.Expenses)
@@ -1387,8 +2020,8 @@ expenseWriteLoop:
 			setDateCellWithFallback(f, expenseSheet, fmt.Sprintf("A%d", row), item.Date)
 			setStringOrNumericCell(f, expenseSheet, fmt.Sprintf("B%d", row), item.JobNumber)
 			setStringOrNumericCell(f, expenseSheet, fmt.Sprintf("C%d", row), item.MaterialCode)
-			_ = setCellPreserveStyle(f, expenseSheet, fmt.Sprintf("D%d", row), strings.TrimSpace(item.Company))
-			_ = setCellPreserveStyle(f, expenseSheet, fmt.Sprintf("E%d", row), normalizeExpenseDescription(item.Description))
+			_ = excel.SetCellPreserveStyle(f, expenseSheet, fmt.Sprintf("D%d", row), excel.SanitizeInput(strings.TrimSpace(item.Company)))
+			_ = excel.SetCellPreserveStyle(f, expenseSheet, fmt.Sprintf("E%d", row), excel.SanitizeInput(normalizeExpenseDescription(item.Description)))
 			setOptionalNumericCell(f, expenseSheet, fmt.Sprintf("F%d", row), item.OfficeDisburse)
 			setOptionalNumericCell(f, expenseSheet, fmt.Sprintf("G%d", row), item.BeforeTax)
 			setOptionalNumericCell(f, expenseSheet, fmt.Sprintf("H%d", row), item.PST)
@@ -1409,7 +2042,7 @@ expenseWriteLoop:
 	for row := mileageStartRow; row <= mileageEndRow; row++ {
 		for _, col := range []string{"A", "B", "C", "D", "E"} {
 			cell := fmt.Sprintf("%s%d", col, row)
-			_ = setCellPreserveStyle(f, mileageSheet, cell, "")
+			_ = excel.SetCellPreserveStyle(f, mileageSheet, cell, "")
 		}
 	}
 	for idx, item := range req.Mileage {
@@ -1417,16 +2050,16 @@ expenseWriteLoop:
 		if row > mileageEndRow {
 			break
 		}
-		_ = setCellPreserveStyle(f, mileageSheet, fmt.Sprintf("A%d", row), normalizeDateTextWithLayout(item.Date, "02-01-06"))
-		_ = setCellPreserveStyle(f, mileageSheet, fmt.Sprintf("B%d", row), strings.TrimSpace(item.From))
-		_ = setCellPreserveStyle(f, mileageSheet, fmt.Sprintf("C%d", row), strings.TrimSpace(item.To))
-		_ = setCellPreserveStyle(f, mileageSheet, fmt.Sprintf("D%d", row), roundTo(item.Distance, 2))
-		_ = setCellPreserveStyle(f, mileageSheet, fmt.Sprintf("E%d", row), roundTo(item.Reimbursement, 2))
+		_ = excel.SetCellPreserveStyle(f, mileageSheet, fmt.Sprintf("A%d", row), normalizeDateTextWithLayout(item.Date, "02-01-06"))
+		_ = excel.SetCellPreserveStyle(f, mileageSheet, fmt.Sprintf("B%d", row), excel.SanitizeInput(strings.TrimSpace(item.From)))
+		_ = excel.SetCellPreserveStyle(f, mileageSheet, fmt.Sprintf("C%d", row), excel.SanitizeInput(strings.TrimSpace(item.To)))
+		_ = excel.SetCellPreserveStyle(f, mileageSheet, fmt.Sprintf("D%d", row), roundTo(item.Distance, 2))
+		_ = excel.SetCellPreserveStyle(f, mileageSheet, fmt.Sprintf("E%d", row), roundTo(item.Reimbursement, 2))
 	}
 	if err := updateMileageFooter(f, mileageSheet, mileageStartRow, mileageFooterRow); err != nil {
 		return nil, fmt.Errorf("update mileage footer: %w", err)
 	}
-	if err := setSheetPrintArea(f, mileageSheet, fmt.Sprintf("$A$1:$E$%d", mileageFooterRow)); err != nil {
+	if err := setSheetPrintArea(f, mileageSheet, fmt.Sprintf("A1:E%d", mileageFooterRow)); err != nil {
 		return nil, fmt.Errorf("set mileage print area: %w", err)
 	}
 	buffer, err := f.WriteToBuffer()
@@ -1434,9 +2067,9 @@ expenseWriteLoop:
 		return nil, fmt.Errorf("write expense/mileage workbook: %w", err)
 	}
 	if originalStylesXML != nil {
-		restoredData, restoreErr := restoreStylesXML(buffer.Bytes(), originalStylesXML)
+		restoredData, restoreErr := excel.RestoreStylesXML(buffer.Bytes(), originalStylesXML)
 		if restoreErr != nil {
-			log.Printf("Warning: Could not restore styles.xml for expense template: %v", restoreErr)
+			slog.WarnContext(ctx, "could not restore styles.xml for expense template", "error", restoreErr)
 			return buffer.Bytes(), nil
 		}
 		return restoredData, nil
@@ -1463,7 +2096,7 @@ func updateMileageFooter(f *excelize.File, sheet string, startRow, footerRow int
 	if endRow < startRow {
 		endRow = startRow
 	}
-	if err := setCellPreserveStyle(f, sheet, fmt.Sprintf("C%d", footerRow), "TOTAL"); err != nil {
+	if err := excel.SetCellPreserveStyle(f, sheet, fmt.Sprintf("C%d", footerRow), "TOTAL"); err != nil {
 		return err
 	}
 	if err := f.SetCellFormula(sheet, fmt.Sprintf("D%d", footerRow), fmt.Sprintf("SUM(D%d:D%d)", startRow, endRow)); err != nil {
@@ -1480,46 +2113,32 @@ func updateMileageFooter(f *excelize.File, sheet string, startRow, footerRow int
 	}
 	return nil
 }
-func setSheetPrintArea(f *excelize.File, sheet, ref string) error {
-	if strings.TrimSpace(sheet) == "" || strings.TrimSpace(ref) == "" {
-		return nil
-	}
-
-	// Cleanup any existing names (new and legacy) before writing.
-	_ = f.DeleteDefinedName(&excelize.DefinedName{
-		Name:  "Print_Area",
-		Scope: sheet,
-	})
-	_ = f.DeleteDefinedName(&excelize.DefinedName{
-		Name: "Print_Area",
-	})
-	_ = f.DeleteDefinedName(&excelize.DefinedName{
-		Name:  "_xlnm.Print_Area",
-		Scope: sheet,
-	})
-	_ = f.DeleteDefinedName(&excelize.DefinedName{
-		Name: "_xlnm.Print_Area",
-	})
 
-	// IMPORTANT: excelize expects "Print_Area" (not "_xlnm.Print_Area").
-	escapedSheet := strings.ReplaceAll(sheet, "'", "''")
-	refersTo := fmt.Sprintf("'%s'!%s", escapedSheet, ref)
-	if err := f.SetDefinedName(&excelize.DefinedName{
-		Name:     "Print_Area",
-		Scope:    sheet,
-		RefersTo: refersTo,
-	}); err != nil {
-		// Never fail workbook generation over print metadata.
-		log.Printf("Warning: could not set print area for sheet %q (%s): %v", sheet, ref, err)
+// setSheetPrintArea makes area ("A1:E30") the print area of sheet. Excel
+// only honours the reserved "_xlnm.Print_Area" name; a plain "Print_Area" is
+// just a user-defined name, so both, and any copy the template defines
+// already, are removed first.
+func setSheetPrintArea(f *excelize.File, sheet, area string) error {
+	ref, err := absoluteRange(area)
+	if err != nil {
+		return err
 	}
-	return nil
+	for _, name := range []string{"_xlnm.Print_Area", "Print_Area"} {
+		_ = f.DeleteDefinedName(&excelize.DefinedName{Name: name, Scope: sheet})
+		_ = f.DeleteDefinedName(&excelize.DefinedName{Name: name})
+	}
+	return f.SetDefinedName(&excelize.DefinedName{
+		Name:     "_xlnm.Print_Area",
+		RefersTo: fmt.Sprintf("'%s'!%s", strings.ReplaceAll(sheet, "'", "''"), ref),
+		Scope:    sheet,
+	})
 }
 func setOptionalNumericCell(f *excelize.File, sheet, cell string, value *float64) {
 	if value == nil {
-		_ = setCellPreserveStyle(f, sheet, cell, "")
+		_ = excel.SetCellPreserveStyle(f, sheet, cell, "")
 		return
 	}
-	_ = setCellPreserveStyle(f, sheet, cell, roundTo(*value, 2))
+	_ = excel.SetCellPreserveStyle(f, sheet, cell, roundTo(*value, 2))
 }
 func ensureExpenseHeaderRow(f *excelize.File, sheet string) {
 	headers := map[string]string{
@@ -1535,21 +2154,21 @@ func ensureExpenseHeaderRow(f *excelize.File, sheet string) {
 		"J8": "Total after Tax",
 	}
 	for cell, value := range headers {
-		_ = setCellPreserveStyle(f, sheet, cell, value)
+		_ = excel.SetCellPreserveStyle(f, sheet, cell, value)
 	}
 }
 func setDateCellWithFallback(f *excelize.File, sheet, cell, value string) {
 	parsed := parseFlexibleDate(value)
 	if !parsed.IsZero() {
-		_ = setCellPreserveStyle(f, sheet, cell, parsed)
+		_ = excel.SetCellPreserveStyle(f, sheet, cell, parsed)
 		return
 	}
-	_ = setCellPreserveStyle(f, sheet, cell, strings.TrimSpace(value))
+	_ = excel.SetCellPreserveStyle(f, sheet, cell, strings.TrimSpace(value))
 }
 func setStringOrNumericCell(f *excelize.File, sheet, cell, value string) {
 	trimmed := strings.TrimSpace(value)
 	if trimmed == "" {
-		_ = setCellPreserveStyle(f, sheet, cell, "")
+		_ = excel.SetCellPreserveStyle(f, sheet, cell, "")
 		return
 	}
 	// For purely numeric codes without leading zeroes, write numeric values so Excel
@@ -1557,12 +2176,12 @@ func setStringOrNumericCell(f *excelize.File, sheet, cell, value string) {
 	if regexp.MustCompile(`^\d+$`).MatchString(trimmed) {
 		if len(trimmed) == 1 || trimmed[0] != '0' {
 			if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
-				_ = setCellPreserveStyle(f, sheet, cell, n)
+				_ = excel.SetCellPreserveStyle(f, sheet, cell, n)
 				return
 			}
 		}
 	}
-	_ = setCellPreserveStyle(f, sheet, cell, trimmed)
+	_ = excel.SetCellPreserveStyle(f, sheet, cell, excel.SanitizeInput(trimmed))
 }
 func applyExpenseSubmissionEmail(f *excelize.File, sheet string, submissionEmail *string) {
 	if submissionEmail == nil {
@@ -1580,14 +2199,14 @@ func applyExpenseSubmissionEmail(f *excelize.File, sheet string, submissionEmail
 	submissionLineRegex := regexp.MustCompile(`(?m)(6\.\s*Submission:\s*Email\s+the\s+form\s+to\s*)([^.\n]+?)(\.\s*)$`)
 	if submissionLineRegex.MatchString(instructions) {
 		updated := submissionLineRegex.ReplaceAllString(instructions, "${1}"+email+".")
-		_ = setCellPreserveStyle(f, sheet, instructionCell, updated)
+		_ = excel.SetCellPreserveStyle(f, sheet, instructionCell, updated)
 		return
 	}
 	// Fallback: replace first email-like value if submission line format changes.
 	emailRegex := regexp.MustCompile(`(?i)[A-Z0-9._%+\-]+@[A-Z0-9.\-]+\.[A-Z]{2,}`)
 	if emailRegex.MatchString(instructions) {
 		updated := emailRegex.ReplaceAllString(instructions, email)
-		_ = setCellPreserveStyle(f, sheet, instructionCell, updated)
+		_ = excel.SetCellPreserveStyle(f, sheet, instructionCell, updated)
 	}
 }
 func groupExpenseItemsByMaterialCode(items []ExpenseLineItem) [][]ExpenseLineItem {
@@ -1712,42 +2331,48 @@ func roundTo(value float64, decimals int) float64 {
 	return math.Round(value*factor) / factor
 }
 
-// generatePDFFile generates a PDF version of the timecard
-// Note: This is a basic implementation. For production use with better formatting,
-// consider using github.com/jung-kurt/gofpdf or github.com/signintech/gopdf
-func generatePDFFile(req TimecardRequest) ([]byte, error) {
-	// Create a simple PDF structure
-	// This is a minimal PDF implementation that creates a basic PDF document
-	// For better formatting, you should use a PDF library like gofpdf
-	var pdf bytes.Buffer
-	// PDF Header
-	pdf.WriteString("%PDF-1.4\n")
-	// For a proper implementation, you would:
-	// 1. Install a PDF library: go get github.com/jung-kurt/gofpdf
-	// 2. Use it to create formatted PDFs with the logo, tables, etc.
-	//
-	// Example with gofpdf:
-	//   pdf := gofpdf.New("L", "mm", "A4", "")
-	//   pdf.AddPage()
-	//   if req.CompanyLogoBase64 != nil {
-	//     // Insert logo
-	//     logoData, _ := base64.StdEncoding.DecodeString(*req.CompanyLogoBase64)
-	//     pdf.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(logoData))
-	//     pdf.Image("logo", 10, 10, 50, 0, false, "", 0, "")
-	//   }
-	//   // Add timecard content...
-	//   return pdf.Output(&pdf), nil
-	// For now, return a simple error message indicating PDF generation needs implementation
-	// You can implement this using your preferred PDF library
-	return nil, fmt.Errorf("PDF generation is not yet fully implemented. Please use Excel output or implement PDF generation using a library like github.com/jung-kurt/gofpdf")
-}
-func sendEmail(to string, cc *string, subject string, body string, attachment []byte, employeeName string) error {
+// sendEmail sends body with the timecard workbook attached, if there is one.
+func sendEmail(ctx context.Context, tenant *TenantConfig, to string, cc *string, replyTo string, subject string, body string, attachment []byte, employeeName string) error {
+	var attachments []email.Attachment
+	if len(attachment) > 0 {
+		attachments = append(attachments, email.Attachment{
+			FileName:    timecardAttachmentName(employeeName, "xlsx"),
+			ContentType: xlsxContentType,
+			Data:        attachment,
+		})
+	}
+	return sendEmailWithAttachments(ctx, tenant, to, cc, replyTo, subject, body, attachments)
+}
+
+// timecardAttachmentName is the file name used for emailed timecards.
+func timecardAttachmentName(employeeName, ext string) string {
+	return fmt.Sprintf("timecard_%s_%s.%s", sanitizeFilename(employeeName), time.Now().Format("2006-01-02"), ext)
+}
+
+// sendEmailWithAttachments delivers one message through the tenant's SMTP
+// settings, or the SMTP_* env config, retrying transient failures.
+func sendEmailWithAttachments(ctx context.Context, tenant *TenantConfig, to string, cc *string, replyTo string, subject string, body string, attachments []email.Attachment) (err error) {
+	ctx, span := tracer.Start(ctx, "send_email", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+	// Don't start an SMTP conversation for a request that has already timed out.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	smtpHost := os.Getenv("SMTP_HOST")
 	smtpPort := os.Getenv("SMTP_PORT")
 	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASS")
+	smtpPass := smtpPassword()
 	fromEmail := os.Getenv("SMTP_FROM")
-	if smtpHost == "" || smtpPort == "" || smtpUser == "" || smtpPass == "" {
+	fromName := strings.TrimSpace(os.Getenv("SMTP_FROM_NAME"))
+	useOAuth2 := strings.EqualFold(strings.TrimSpace(os.Getenv("SMTP_AUTH_TYPE")), "oauth2")
+	if tenant != nil && tenant.SMTP != nil {
+		// Tenant SMTP settings replace the env config entirely, using password auth.
+		smtpHost, smtpPort = tenant.SMTP.Host, tenant.SMTP.Port
+		smtpUser, smtpPass = tenant.SMTP.User, tenant.SMTP.Pass
+		fromEmail, fromName = tenant.SMTP.From, strings.TrimSpace(tenant.SMTP.FromName)
+		useOAuth2 = false
+	}
+	if smtpHost == "" || smtpPort == "" || smtpUser == "" || (smtpPass == "" && !useOAuth2) {
 		return fmt.Errorf("SMTP not configured")
 	}
 	if fromEmail == "" {
@@ -1760,57 +2385,102 @@ func sendEmail(to string, cc *string, subject string, body string, attachment []
 	}
 	allRecipients := append([]string{}, recipients...)
 	allRecipients = append(allRecipients, ccRecipients...)
-	fileName := fmt.Sprintf("timecard_%s_%s.xlsx",
-		strings.ReplaceAll(employeeName, " ", "_"),
-		time.Now().Format("2006-01-02"))
-	message := buildEmailMessage(fromEmail, recipients, ccRecipients, subject, body, attachment, fileName)
+	// Format the From header with an optional display name (RFC 2822); the SMTP
+	// envelope sender below stays the bare address.
+	fromHeader := (&mail.Address{Name: fromName, Address: fromEmail}).String()
+	// Carry the trace context to the mail server as traceparent/tracestate headers.
+	message := traceHeaders(ctx) + email.Message(fromHeader, strings.TrimSpace(replyTo), recipients, ccRecipients, subject, body, attachments)
 	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
+	if useOAuth2 {
+		accessToken, err := getSMTPOAuth2AccessToken()
+		if err != nil {
+			return fmt.Errorf("failed to get SMTP OAuth2 token: %v", err)
+		}
+		auth = email.XOAuth2Auth(smtpUser, accessToken, smtpTLSMode == email.ModeNone)
+	} else if smtpTLSMode == email.ModeNone {
+		auth = email.PlaintextAuth(smtpUser, smtpPass)
+	}
 	addr := fmt.Sprintf("%s:%s", smtpHost, smtpPort)
-	err := smtp.SendMail(addr, auth, fromEmail, allRecipients, []byte(message))
+	err = email.Retry(ctx, getEnvInt("SMTP_MAX_RETRIES", 3)+1, func() error {
+		return email.Send(ctx, addr, auth, fromEmail, allRecipients, []byte(message), smtpTLSMode)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to send email: %v", err)
 	}
-	log.Printf("Email sent successfully to %s", to)
+	slog.InfoContext(ctx, "email sent", "to", to)
 	return nil
 }
-func buildEmailMessage(from string, to []string, cc []string, subject string, body string, attachment []byte, fileName string) string {
-	boundary := "==BOUNDARY=="
-	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf("From: %s\r\n", from))
-	buf.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(to, ", ")))
-	if len(cc) > 0 {
-		buf.WriteString(fmt.Sprintf("Cc: %s\r\n", strings.Join(cc, ", ")))
-	}
-	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
-	buf.WriteString("MIME-Version: 1.0\r\n")
-	buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", boundary))
-	buf.WriteString("\r\n")
-	buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	buf.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
-	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-	buf.WriteString("\r\n")
-	buf.WriteString(body)
-	buf.WriteString("\r\n\r\n")
-	if len(attachment) > 0 {
-		buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		buf.WriteString("Content-Type: application/vnd.openxmlformats-officedocument.spreadsheetml.sheet\r\n")
-		buf.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", fileName))
-		buf.WriteString("Content-Transfer-Encoding: base64\r\n")
-		buf.WriteString("\r\n")
-		encoded := base64.StdEncoding.EncodeToString(attachment)
-		for i := 0; i < len(encoded); i += 76 {
-			end := i + 76
-			if end > len(encoded) {
-				end = len(encoded)
-			}
-			buf.WriteString(encoded[i:end])
-			buf.WriteString("\r\n")
-		}
-		buf.WriteString("\r\n")
+
+// smtpOAuth2Cache holds the current SMTP access token so we only hit the token
+// endpoint when the cached one is close to expiring.
+var smtpOAuth2Cache struct {
+	sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// smtpOAuth2RedisKey is where instances share the SMTP access token when REDIS_URL
+// is set, so each pod doesn't hit the token endpoint on its own.
+const smtpOAuth2RedisKey = "smtp:oauth2:token"
+
+// getSMTPOAuth2AccessToken exchanges SMTP_OAUTH2_REFRESH_TOKEN for an access token at
+// SMTP_OAUTH2_TOKEN_URL, reusing the cached token until 5 minutes before it expires.
+// With Redis configured, a token another instance already fetched is reused first.
+func getSMTPOAuth2AccessToken() (string, error) {
+	smtpOAuth2Cache.Lock()
+	defer smtpOAuth2Cache.Unlock()
+	if smtpOAuth2Cache.accessToken != "" && time.Now().Add(5*time.Minute).Before(smtpOAuth2Cache.expiry) {
+		return smtpOAuth2Cache.accessToken, nil
+	}
+	if token, expiry, ok := sharedTokenGet(smtpOAuth2RedisKey); ok {
+		smtpOAuth2Cache.accessToken = token
+		smtpOAuth2Cache.expiry = expiry
+		return token, nil
+	}
+	refreshToken := strings.TrimSpace(os.Getenv("SMTP_OAUTH2_REFRESH_TOKEN"))
+	tokenURL := strings.TrimSpace(os.Getenv("SMTP_OAUTH2_TOKEN_URL"))
+	if refreshToken == "" || tokenURL == "" {
+		return "", fmt.Errorf("SMTP_OAUTH2_REFRESH_TOKEN and SMTP_OAUTH2_TOKEN_URL must be set")
+	}
+	conf := &oauth2.Config{
+		ClientID:     os.Getenv("SMTP_OAUTH2_CLIENT_ID"),
+		ClientSecret: smtpOAuth2ClientSecret(),
+		Endpoint:     oauth2.Endpoint{TokenURL: tokenURL},
+	}
+	token, err := conf.TokenSource(context.Background(), &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		return "", err
 	}
-	buf.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	return buf.String()
+	smtpOAuth2Cache.accessToken = token.AccessToken
+	smtpOAuth2Cache.expiry = token.Expiry
+	if token.Expiry.IsZero() {
+		// No expiry reported; treat the token as valid for an hour.
+		smtpOAuth2Cache.expiry = time.Now().Add(time.Hour)
+	}
+	sharedTokenSet(smtpOAuth2RedisKey, token.AccessToken, smtpOAuth2Cache.expiry)
+	slog.Info("refreshed SMTP OAuth2 access token", "expires_at", smtpOAuth2Cache.expiry.Format(time.RFC3339))
+	return token.AccessToken, nil
 }
+
+// smtpTLSMode is the transport security for SMTP_* and tenant SMTP servers.
+var smtpTLSMode = email.ModeStartTLS
+
+// loadSMTPTLSMode reads SMTP_TLS_MODE. Anything other than starttls, tls or
+// none is an error: email.Send would otherwise treat it as plaintext.
+func loadSMTPTLSMode() error {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_TLS_MODE"))); mode {
+	case "":
+	case email.ModeStartTLS, email.ModeTLS, email.ModeNone:
+		smtpTLSMode = mode
+	default:
+		return fmt.Errorf("SMTP_TLS_MODE must be %s, %s or %s, got %q", email.ModeStartTLS, email.ModeTLS, email.ModeNone, mode)
+	}
+	if smtpTLSMode == email.ModeNone {
+		slog.Warn("SMTP_TLS_MODE=none — plaintext SMTP enabled")
+	}
+	return nil
+}
+
 func splitAndTrim(s string) []string {
 	parts := strings.Split(s, ",")
 	out := make([]string, 0, len(parts))
@@ -1822,6 +2492,18 @@ func splitAndTrim(s string) []string {
 	}
 	return out
 }
+func getEnvInt(key string, fallback int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("invalid integer env var, using default", "key", key, "value", v, "default", fallback)
+		return fallback
+	}
+	return n
+}
 func getEnvFloat(key string) (*float64, error) {
 	v := strings.TrimSpace(os.Getenv(key))
 	if v == "" {
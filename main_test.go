@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// generateTestWorkbook runs generateExcelFile against the default template
+// and opens the result.
+func generateTestWorkbook(t *testing.T, req TimecardRequest) *excelize.File {
+	t.Helper()
+	data, err := generateExcelFile(context.Background(), nil, req)
+	if err != nil {
+		t.Fatalf("generateExcelFile: %v", err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestGenerateExcelFileEscapesFormulas(t *testing.T) {
+	f := generateTestWorkbook(t, TimecardRequest{
+		EmployeeName:  "=SUM(A1:A10)",
+		PayPeriodNum:  3,
+		Year:          2024,
+		WeekStartDate: "2024-01-07T00:00:00Z",
+		Jobs:          []Job{{JobNumber: "-5", JobName: "@Plant"}},
+		Entries: []Entry{
+			{Date: "2024-01-08T00:00:00Z", JobNumber: "-5", LabourCode: "+1", Hours: 8},
+		},
+	})
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"M2", "'=SUM(A1:A10)"}, // employee name
+		{"C4", "'+1"},           // labour code
+		{"D4", "'-5"},           // job number
+	}
+	for _, tt := range tests {
+		got, err := f.GetCellValue("Week 1", tt.cell)
+		if err != nil {
+			t.Fatalf("GetCellValue(%s): %v", tt.cell, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestFillWeekSheet(t *testing.T) {
+	const sheet = "Week 1"
+	entry := func(date, job, code string, hours float64) Entry {
+		return Entry{Date: date + "T00:00:00Z", JobNumber: job, LabourCode: code, Hours: hours}
+	}
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    map[string]string // cell -> raw value
+	}{
+		{
+			name:    "week start date serial",
+			entries: []Entry{entry("2024-01-08", "234", "227", 8)},
+			want:    map[string]string{"B4": "45298", "B5": "45298", "B11": "45304"},
+		},
+		{
+			name:    "regular hours",
+			entries: []Entry{entry("2024-01-07", "234", "227", 8)},
+			want:    map[string]string{"C4": "227", "D4": "234", "D5": "8"},
+		},
+		{
+			name: "overtime hours",
+			entries: []Entry{
+				{Date: "2024-01-07T00:00:00Z", JobNumber: "234", LabourCode: "227", Hours: 2, Overtime: true},
+			},
+			want: map[string]string{"C15": "227", "D15": "234", "D16": "2", "D5": ""},
+		},
+		{
+			name: "night shift",
+			entries: []Entry{
+				{Date: "2024-01-09T00:00:00Z", JobNumber: "234", LabourCode: "227", Hours: 6, IsNightShift: true},
+			},
+			want: map[string]string{"C4": "N227", "D4": "234", "D7": "6"},
+		},
+		{
+			name: "entry outside the week",
+			entries: []Entry{
+				entry("2024-01-07", "234", "227", 8),
+				entry("2024-01-14", "234", "227", 5),
+			},
+			want: map[string]string{"D5": "8", "D12": ""},
+		},
+		{
+			name:    "job not in the job list",
+			entries: []Entry{entry("2024-01-07", "999", "227", 4)},
+			want:    map[string]string{"D4": "999", "D5": "4"},
+		},
+		{
+			name: "duplicate entries are summed",
+			entries: []Entry{
+				entry("2024-01-10", "234", "227", 3),
+				entry("2024-01-10", "234", "227", 4.5),
+			},
+			want: map[string]string{"D8": "7.5", "F4": "Job:"}, // no second column
+		},
+	}
+	template, err := embeddedTemplates.ReadFile("template.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := excelize.OpenReader(bytes.NewReader(template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			req := TimecardRequest{
+				EmployeeName: "Jane Doe",
+				PayPeriodNum: 3,
+				Year:         2024,
+				Jobs:         []Job{{JobNumber: "234", JobName: "Plant"}},
+			}
+			week := WeekData{WeekNumber: 1, WeekStartDate: "2024-01-07T00:00:00Z", WeekLabel: "Week 1", Entries: tt.entries}
+			if err := fillWeekSheet(context.Background(), f, sheet, req, week, 1, map[string]string{"234": "Plant"}); err != nil {
+				t.Fatalf("fillWeekSheet: %v", err)
+			}
+			for cell, want := range tt.want {
+				got, err := f.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+				if err != nil {
+					t.Fatalf("GetCellValue(%s): %v", cell, err)
+				}
+				if got != want {
+					t.Errorf("%s = %q, want %q", cell, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Jane Doe", "Jane_Doe"},
+		{"José Núñez", "Jose_Nunez"},
+		{"../../etc/passwd", "____etc_passwd"},
+		{`C:\Windows\system32`, "C__Windows_system32"},
+		{".hidden", "hidden"},
+		{"..", "_"},
+		{"   ", "employee"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmployeeNameStaysInsideDirectory(t *testing.T) {
+	for _, name := range []string{"../../etc/passwd", `..\..\boot.ini`, "/etc/passwd", "a/../../b"} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, timecardAttachmentName(name, "xlsx"))
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		if filepath.Dir(path) != dir {
+			t.Errorf("%q: file written to %s, outside %s", name, path, dir)
+		}
+		segments := strings.Split(timecardStorageKey(TimecardRequest{EmployeeName: name, Year: 2024, PayPeriodNum: 3}, "xlsx"), "/")
+		if len(segments) != 5 {
+			t.Errorf("%q: storage key has segments %q, want the name as one segment", name, segments)
+		}
+	}
+}
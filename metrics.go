@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus collectors, served at /metrics when ENABLE_METRICS=true.
+var (
+	generateTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "timecard_generate_total",
+		Help: "Timecard workbook generations by outcome.",
+	}, []string{"status"})
+	generateDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "timecard_generate_duration_seconds",
+		Help:    "Time spent generating timecard workbooks.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30},
+	})
+	pdfConversionTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "timecard_pdf_conversion_total",
+		Help: "PDF conversions by backend and outcome.",
+	}, []string{"backend", "status"})
+	pdfConversionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "timecard_pdf_conversion_duration_seconds",
+		Help:    "Time spent converting timecards to PDF.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30},
+	}, []string{"backend"})
+	emailSendTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_send_total",
+		Help: "Timecard emails by outcome.",
+	}, []string{"status"})
+)
+
+func init() {
+	prometheus.MustRegister(generateTotal, generateDuration, pdfConversionTotal, pdfConversionDuration, emailSendTotal)
+}
+
+// Totals mirrored from the Prometheus counters for /api/status, which reports
+// them whether or not /metrics is enabled.
+var (
+	totalGenerates atomic.Int64
+	totalEmails    atomic.Int64
+	lastGenerateAt atomic.Int64 // unix nanoseconds of the last successful generation
+)
+
+// recordGenerate counts one workbook generation.
+func recordGenerate(err error) {
+	generateTotal.WithLabelValues(metricStatus(err)).Inc()
+	totalGenerates.Add(1)
+	if err == nil {
+		lastGenerateAt.Store(time.Now().UnixNano())
+	}
+}
+
+// recordEmail counts one email send attempt.
+func recordEmail(err error) {
+	emailSendTotal.WithLabelValues(metricStatus(err)).Inc()
+	totalEmails.Add(1)
+}
+
+// metricStatus maps an error to the "ok"/"error" status label.
+func metricStatus(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// chain wraps h in mw so that the first middleware listed is the outermost:
+// chain(h, a, b) serves a(b(h)).
+func chain(h http.Handler, mw ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// withTimeout runs h under http.TimeoutHandler: after d the request context is
+// cancelled and the client gets 503 with a request_timeout error. The handler's
+// response is buffered until it finishes, so this is only for handlers that
+// write one small response.
+func withTimeout(h http.HandlerFunc, d time.Duration) http.HandlerFunc {
+	body, _ := json.Marshal(APIError{Code: ErrRequestTimeout, Message: "Request timed out after " + d.String()})
+	timeout := http.TimeoutHandler(h, d, string(body))
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TimeoutHandler writes its body straight to w; a successful response
+		// replaces this header with the handler's own.
+		w.Header().Set("Content-Type", "application/json")
+		timeout.ServeHTTP(w, r)
+	}
+}
+
+// generateTimeout bounds /api/generate-timecard (GENERATE_TIMEOUT_SECONDS,
+// default 120).
+func generateTimeout() time.Duration {
+	return time.Duration(getEnvInt("GENERATE_TIMEOUT_SECONDS", 120)) * time.Second
+}
+
+// emailTimeout bounds a request that generates and sends one email
+// (EMAIL_TIMEOUT_SECONDS, default 180).
+func emailTimeout() time.Duration {
+	return time.Duration(getEnvInt("EMAIL_TIMEOUT_SECONDS", 180)) * time.Second
+}
+
+// corsMiddleware allows browser clients on any origin and answers preflight
+// OPTIONS requests itself.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, X-Tenant-ID, If-None-Match, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Deprecation, Link, ETag, X-Idempotent-Replayed, X-Timecard-Hours-Summary, X-Timecard-Job-Hours")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loggingMiddleware writes one access log line per request. It sits inside
+// requestIDMiddleware so the line carries request_id.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		slog.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", sw.status,
+			"bytes", sw.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// statusResponseWriter remembers the status code and body size for logging.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (sw *statusResponseWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status = status
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusResponseWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// PayPeriod is one pay period, numbered from 1 within the year its start date
+// falls in.
+type PayPeriod struct {
+	PayPeriodNum int             `json:"pay_period_num"`
+	Start        string          `json:"start"`
+	End          string          `json:"end"`
+	Weeks        []PayPeriodWeek `json:"weeks"`
+}
+
+type PayPeriodWeek struct {
+	Week  int    `json:"week"`
+	Start string `json:"start"`
+}
+
+// payPeriodCalendar reads FIRST_PAY_PERIOD_START (YYYY-MM-DD) and
+// PAY_PERIOD_LENGTH_DAYS (default 14). Any period start works as the anchor;
+// periods repeat forwards and backwards from it.
+func payPeriodCalendar() (time.Time, int, error) {
+	raw := os.Getenv("FIRST_PAY_PERIOD_START")
+	if raw == "" {
+		return time.Time{}, 0, fmt.Errorf("FIRST_PAY_PERIOD_START is not set")
+	}
+	anchor, err := time.Parse(dateLayout, raw)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("FIRST_PAY_PERIOD_START must be YYYY-MM-DD: %w", err)
+	}
+	length := getEnvInt("PAY_PERIOD_LENGTH_DAYS", 14)
+	if length < 1 {
+		return time.Time{}, 0, fmt.Errorf("PAY_PERIOD_LENGTH_DAYS must be positive")
+	}
+	return anchor, length, nil
+}
+
+// payPeriodsForYear returns every pay period that starts in year.
+func payPeriodsForYear(anchor time.Time, length, year int) []PayPeriod {
+	jan1 := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	// Step from the anchor to the first period starting on or after Jan 1.
+	offset := int(jan1.Sub(anchor).Hours() / 24)
+	steps := offset / length
+	if offset > 0 && offset%length != 0 {
+		steps++
+	} else if offset < 0 {
+		steps = -((-offset) / length)
+	}
+	start := anchor.AddDate(0, 0, steps*length)
+	var periods []PayPeriod
+	for num := 1; start.Year() == year; num++ {
+		periods = append(periods, newPayPeriod(num, start, length))
+		start = start.AddDate(0, 0, length)
+	}
+	return periods
+}
+
+func newPayPeriod(num int, start time.Time, length int) PayPeriod {
+	period := PayPeriod{
+		PayPeriodNum: num,
+		Start:        start.Format(dateLayout),
+		End:          start.AddDate(0, 0, length-1).Format(dateLayout),
+	}
+	for day, week := 0, 1; day < length; day, week = day+7, week+1 {
+		period.Weeks = append(period.Weeks, PayPeriodWeek{Week: week, Start: start.AddDate(0, 0, day).Format(dateLayout)})
+	}
+	return period
+}
+
+// payPeriodsHandler handles GET /api/pay-periods?year=.
+func payPeriodsHandler(w http.ResponseWriter, r *http.Request) {
+	anchor, length, ok := payPeriodCalendarOrError(w, r)
+	if !ok {
+		return
+	}
+	year := time.Now().UTC().Year()
+	if v := r.URL.Query().Get("year"); v != "" {
+		var err error
+		if year, err = strconv.Atoi(v); err != nil || year < 1 {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: year must be a positive number"})
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payPeriodsForYear(anchor, length, year))
+}
+
+// currentPayPeriodHandler handles GET /api/pay-periods/current.
+func currentPayPeriodHandler(w http.ResponseWriter, r *http.Request) {
+	anchor, length, ok := payPeriodCalendarOrError(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	today := now.Format(dateLayout)
+	// The period containing today started either this year or late last year.
+	for _, year := range []int{now.Year(), now.Year() - 1} {
+		periods := payPeriodsForYear(anchor, length, year)
+		for i := len(periods) - 1; i >= 0; i-- {
+			if periods[i].Start <= today && today <= periods[i].End {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(periods[i])
+				return
+			}
+		}
+	}
+	respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "No pay period contains today"})
+}
+
+// payPeriodCalendarOrError is payPeriodCalendar for handlers: it answers 503
+// itself when the calendar isn't configured.
+func payPeriodCalendarOrError(w http.ResponseWriter, r *http.Request) (time.Time, int, bool) {
+	anchor, length, err := payPeriodCalendar()
+	if err != nil {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: fmt.Sprintf("Pay period calendar is not configured: %v", err)})
+		return time.Time{}, 0, false
+	}
+	return anchor, length, true
+}
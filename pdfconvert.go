@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"timecard-api/internal/pdf"
+)
+
+// availablePDFConverters lists every converter built into this binary, by the
+// name used in PDF_CONVERTERS.
+var availablePDFConverters = map[string]pdf.Converter{
+	"gofpdf": pdf.GoFPDF{},
+}
+
+// pdfConverters is the order converters are tried in, from PDF_CONVERTERS
+// (comma-separated, default "gofpdf").
+var pdfConverters = []pdf.Converter{pdf.GoFPDF{}}
+
+func loadPDFConverters() {
+	raw := strings.TrimSpace(os.Getenv("PDF_CONVERTERS"))
+	if raw == "" {
+		return
+	}
+	var chain []pdf.Converter
+	for _, name := range splitAndTrim(strings.ToLower(raw)) {
+		converter, ok := availablePDFConverters[name]
+		if !ok {
+			slog.Warn("unknown PDF converter, skipping", "name", name)
+			continue
+		}
+		chain = append(chain, converter)
+	}
+	if len(chain) == 0 {
+		slog.Error("PDF_CONVERTERS names no available converter, keeping defaults", "value", raw)
+		return
+	}
+	pdfConverters = chain
+	names := make([]string, len(chain))
+	for i, converter := range chain {
+		names[i] = converter.Name()
+	}
+	slog.Info("PDF converters loaded", "order", names)
+}
+
+// convertExcelToPDF converts a workbook with the first converter in
+// pdfConverters that succeeds, and fails only if every one does.
+func convertExcelToPDF(ctx context.Context, excelData []byte) (_ []byte, err error) {
+	ctx, span := tracer.Start(ctx, "convert_pdf")
+	defer func() { endSpan(span, err) }()
+	dir, err := os.MkdirTemp("", "timecard-pdf-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	// MkdirTemp asks for 0700 but the umask and platform have the last word;
+	// payroll data must not be readable by anyone else.
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("restrict temp dir: %w", err)
+	}
+	excelPath := filepath.Join(dir, "timecard.xlsx")
+	if err := pdf.WritePrivateFile(excelPath, excelData); err != nil {
+		return nil, fmt.Errorf("write workbook: %w", err)
+	}
+	var errs []error
+	for _, converter := range pdfConverters {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pdfPath := filepath.Join(dir, converter.Name()+".pdf")
+		timer := prometheus.NewTimer(pdfConversionDuration.WithLabelValues(converter.Name()))
+		err := converter.Convert(ctx, excelPath, pdfPath)
+		timer.ObserveDuration()
+		pdfConversionTotal.WithLabelValues(converter.Name(), metricStatus(err)).Inc()
+		if err == nil {
+			var pdfData []byte
+			if pdfData, err = os.ReadFile(pdfPath); err == nil {
+				span.SetAttributes(attribute.String("backend", converter.Name()))
+				return pdfData, nil
+			}
+		}
+		slog.WarnContext(ctx, "PDF converter failed", "converter", converter.Name(), "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", converter.Name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// photoLookupTimeout bounds the DNS lookup isAllowedPhotoURL does
+	// before any request goes out.
+	photoLookupTimeout = 3 * time.Second
+	photoFetchTimeout  = 10 * time.Second
+	maxPhotoBytes      = 2 << 20
+	maxPhotoRedirects  = 3
+)
+
+var errURLNotAllowed = errors.New("URL not allowed")
+
+// blockedPhotoPrefixes are the ranges net/netip has no predicate for:
+// carrier-grade NAT, the benchmarking range and the AWS IPv6 metadata
+// address. Private, loopback, link-local (which covers 169.254.169.254)
+// and unspecified addresses are checked in isPublicPhotoAddr.
+var blockedPhotoPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("fd00:ec2::254/128"),
+}
+
+// isPublicPhotoAddr reports whether addr is somewhere a photo may be
+// fetched from.
+func isPublicPhotoAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range blockedPhotoPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAllowedPhotoURL checks an employee photo URL before the server fetches
+// it: the scheme must be https and every address the host resolves to
+// must be public.
+func isAllowedPhotoURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errURLNotAllowed, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be https", errURLNotAllowed)
+	}
+	host := u.Hostname()
+	if host == "" || u.User != nil {
+		return fmt.Errorf("%w: missing host or embedded credentials", errURLNotAllowed)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), photoLookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: resolving %s: %v", errURLNotAllowed, host, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: %s has no addresses", errURLNotAllowed, host)
+	}
+	for _, addr := range addrs {
+		if !isPublicPhotoAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to non-public address %s", errURLNotAllowed, host, addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// photoDialControl rejects the connection if the address actually dialled
+// is not public, so a DNS answer that changes between isAllowedPhotoURL and
+// the fetch cannot reach an internal host.
+func photoDialControl(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errURLNotAllowed, err)
+	}
+	if !isPublicPhotoAddr(ap.Addr()) {
+		return fmt.Errorf("%w: refusing to dial %s", errURLNotAllowed, ap.Addr().Unmap())
+	}
+	return nil
+}
+
+// photoClient ignores proxy settings so the dial check sees the real
+// destination, and re-validates every redirect.
+var photoClient = &http.Client{
+	Timeout: photoFetchTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: photoLookupTimeout, Control: photoDialControl}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        4,
+		IdleConnTimeout:     30 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxPhotoRedirects {
+			return fmt.Errorf("%w: too many redirects", errURLNotAllowed)
+		}
+		return isAllowedPhotoURL(req.URL.String())
+	},
+}
+
+// fetchEmployeePhoto downloads a PNG or JPEG employee photo and returns it
+// base64 encoded, ready for insertLogoIntoSheetFitted.
+func fetchEmployeePhoto(ctx context.Context, rawURL string) (string, error) {
+	if err := isAllowedPhotoURL(rawURL); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "image/png, image/jpeg")
+	resp, err := photoClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching employee photo: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching employee photo: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("reading employee photo: %w", err)
+	}
+	if len(data) > maxPhotoBytes {
+		return "", fmt.Errorf("employee photo exceeds %d bytes", maxPhotoBytes)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || (format != "png" && format != "jpeg") {
+		return "", fmt.Errorf("employee photo is not a PNG or JPEG image")
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// checkEmployeePhotoURL answers 400 and returns false when the request
+// carries a photo URL the server must not fetch.
+func checkEmployeePhotoURL(w http.ResponseWriter, r *http.Request, req TimecardRequest) bool {
+	if req.EmployeePhotoURL == "" {
+		return true
+	}
+	if err := isAllowedPhotoURL(req.EmployeePhotoURL); err != nil {
+		slog.WarnContext(r.Context(), "rejected employee photo URL", "error", err)
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrPhotoURLNotAllowed, Message: err.Error()})
+		return false
+	}
+	return true
+}
+
+// insertEmployeePhoto places the employee photo on every week sheet. Like
+// the company logo, a photo that cannot be fetched is logged and skipped
+// rather than failing the timecard.
+func insertEmployeePhoto(ctx context.Context, f *excelize.File, req TimecardRequest, sheets []string) {
+	photo, err := fetchEmployeePhoto(ctx, req.EmployeePhotoURL)
+	if err != nil {
+		slog.WarnContext(ctx, "could not fetch employee photo", "error", err)
+		return
+	}
+	placed := make(map[string]bool)
+	for _, week := range req.Weeks {
+		sheetName, _ := weekSheetName(sheets, week.WeekNumber)
+		if placed[sheetName] {
+			continue
+		}
+		placed[sheetName] = true
+		if err := insertLogoIntoSheetFitted(f, photo, sheetName, sheetLayout.EmployeePhotoCell, 62, 62, 4, 4); err != nil {
+			slog.WarnContext(ctx, "could not insert employee photo", "sheet", sheetName, "error", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPoolFull is returned by Submit when every worker is busy.
+var ErrPoolFull = errors.New("worker pool is full")
+
+// WorkerPool bounds how many workbooks are built at once. Its semaphore
+// holds one token per running task.
+type WorkerPool struct {
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	queued atomic.Int64
+}
+
+// NewWorkerPool returns a pool running at most size tasks at a time.
+func NewWorkerPool(size int) *WorkerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &WorkerPool{sem: make(chan struct{}, size)}
+}
+
+// Submit runs fn on a new goroutine if a worker is free and returns
+// ErrPoolFull otherwise, without waiting.
+func (p *WorkerPool) Submit(ctx context.Context, fn func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		return ErrPoolFull
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.release()
+		fn()
+	}()
+	return nil
+}
+
+// Do waits for a free worker, counting as queued meanwhile, and runs fn on
+// the calling goroutine. It returns ctx's error if ctx ends first.
+func (p *WorkerPool) Do(ctx context.Context, fn func()) error {
+	p.queued.Add(1)
+	select {
+	case p.sem <- struct{}{}:
+		p.queued.Add(-1)
+	case <-ctx.Done():
+		p.queued.Add(-1)
+		return ctx.Err()
+	}
+	p.wg.Add(1)
+	defer p.release()
+	fn()
+	return nil
+}
+
+func (p *WorkerPool) release() {
+	<-p.sem
+	p.wg.Done()
+}
+
+// Drain waits for every running task to finish.
+func (p *WorkerPool) Drain() {
+	p.wg.Wait()
+}
+
+// PoolStats is the body of GET /admin/pool-stats.
+type PoolStats struct {
+	Capacity int   `json:"capacity"`
+	InFlight int   `json:"in_flight"`
+	Queued   int64 `json:"queued"`
+}
+
+func (p *WorkerPool) Stats() PoolStats {
+	return PoolStats{Capacity: cap(p.sem), InFlight: len(p.sem), Queued: p.queued.Load()}
+}
+
+// generatePool runs batch items and async jobs, WORKER_POOL_SIZE (default
+// 8) at a time between them.
+var generatePool = NewWorkerPool(8)
+
+func initWorkerPool() {
+	generatePool = NewWorkerPool(getEnvInt("WORKER_POOL_SIZE", 8))
+	slog.Info("worker pool started", "size", cap(generatePool.sem))
+}
+
+// poolStatsHandler handles GET /admin/pool-stats.
+func poolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(generatePool.Stats())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+)
+
+// adminAllowedNets (ADMIN_ALLOWED_CIDR) are the networks allowed to reach
+// the pprof endpoints. When empty only loopback callers are.
+var adminAllowedNets []*net.IPNet
+
+// registerPprof adds the /debug/pprof/ handlers to mux when ENABLE_PPROF is
+// true. They are registered by hand because the package's init only wires
+// up http.DefaultServeMux, which this server doesn't use.
+func registerPprof(mux *http.ServeMux) {
+	if !strings.EqualFold(os.Getenv("ENABLE_PPROF"), "true") {
+		return
+	}
+	adminAllowedNets = nil
+	for _, entry := range splitAndTrim(os.Getenv("ADMIN_ALLOWED_CIDR")) {
+		network, err := parseProxyCIDR(entry)
+		if err != nil {
+			slog.Warn("ignoring invalid ADMIN_ALLOWED_CIDR entry", "entry", entry, "error", err)
+			continue
+		}
+		adminAllowedNets = append(adminAllowedNets, network)
+	}
+	slog.Warn("⚠️  pprof enabled — ensure ADMIN_ALLOWED_CIDR is set", "path", "/debug/pprof/", "allowed_networks", len(adminAllowedNets))
+	mux.Handle("/debug/pprof/", requireAdminNetwork(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", requireAdminNetwork(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", requireAdminNetwork(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", requireAdminNetwork(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", requireAdminNetwork(http.HandlerFunc(pprof.Trace)))
+}
+
+// requireAdminNetwork answers 403 unless the caller's address is in
+// ADMIN_ALLOWED_CIDR (or is loopback when that is unset).
+func requireAdminNetwork(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr := realIP(r, trustedProxies)
+		ip := net.ParseIP(addr)
+		allowed := ip != nil && ip.IsLoopback()
+		if len(adminAllowedNets) > 0 {
+			allowed = ip != nil && isTrustedProxy(ip, adminAllowedNets)
+		}
+		if !allowed {
+			slog.WarnContext(r.Context(), "pprof request refused", "client_ip", addr)
+			respondError(w, r, http.StatusForbidden, APIError{Code: ErrForbidden, Message: "Forbidden"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
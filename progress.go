@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Progress stages reported for async jobs on GET /api/jobs/{id}/progress.
+const (
+	ProgressQueued     = "queued"
+	ProgressGenerating = "generating"
+	ProgressFinalizing = "finalizing"
+	ProgressDone       = "done"
+	ProgressError      = "error"
+)
+
+// progressKeepAlive is how often an idle progress stream sends a comment so
+// proxies don't close it.
+const progressKeepAlive = 15 * time.Second
+
+// ProgressEvent is one Server-Sent Event on a progress stream.
+type ProgressEvent struct {
+	Stage   string `json:"stage"`
+	Percent int    `json:"percent"`
+	Message string `json:"message,omitempty"`
+}
+
+type progressKey struct{}
+
+// withProgress makes report receive the stages reportProgress records under ctx.
+func withProgress(ctx context.Context, report func(stage string, percent int)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// reportProgress records a generation stage; it does nothing outside an async job.
+func reportProgress(ctx context.Context, stage string, percent int) {
+	if report, ok := ctx.Value(progressKey{}).(func(string, int)); ok {
+		report(stage, percent)
+	}
+}
+
+// setProgress updates the job's stage and wakes every stream watching it.
+// The caller must hold status.mu.
+func (status *JobStatus) setProgress(stage string, percent int) {
+	status.Stage = stage
+	status.Percent = percent
+	if status.progressChanged != nil {
+		close(status.progressChanged)
+	}
+	status.progressChanged = make(chan struct{})
+}
+
+// progressSnapshot returns the current event, whether it is the last one, and
+// a channel closed on the next change.
+func (status *JobStatus) progressSnapshot() (ProgressEvent, bool, <-chan struct{}) {
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	if status.progressChanged == nil {
+		status.progressChanged = make(chan struct{})
+	}
+	switch status.Status {
+	case JobStatusDone:
+		return ProgressEvent{Stage: ProgressDone, Percent: 100}, true, status.progressChanged
+	case JobStatusError:
+		return ProgressEvent{Stage: ProgressError, Percent: status.Percent, Message: status.ErrorMessage}, true, status.progressChanged
+	}
+	stage := status.Stage
+	if stage == "" {
+		stage = ProgressQueued
+	}
+	return ProgressEvent{Stage: stage, Percent: status.Percent}, false, status.progressChanged
+}
+
+// jobProgressHandler handles GET /api/jobs/{id}/progress: a text/event-stream
+// that sends the job's stage each time it changes and closes after the done
+// or error event.
+func jobProgressHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	status, ok := lookupJob(r.Context(), r.PathValue("id"))
+	if !ok {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "Job not found"})
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	keepAlive := time.NewTicker(progressKeepAlive)
+	defer keepAlive.Stop()
+	var last ProgressEvent
+	for first := true; ; first = false {
+		event, final, changed := status.progressSnapshot()
+		if first || event != last {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			if err := rc.Flush(); err != nil {
+				slog.WarnContext(ctx, "progress stream cannot flush", "job_id", status.ID, "error", err)
+				return
+			}
+			last = event
+		}
+		if final {
+			return
+		}
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientLimiter is the token bucket for one client IP plus when we last saw it.
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	mu       sync.Mutex
+	lastSeen time.Time
+}
+
+var (
+	clientLimiters    sync.Map // client IP -> *clientLimiter
+	rateLimitRPS      = 10.0
+	rateLimitBurst    = 20
+	limiterIdleTTL    = 5 * time.Minute
+	limiterSweepEvery = time.Minute
+)
+
+// initRateLimiter reads RATE_LIMIT_RPS / RATE_LIMIT_BURST and starts the background
+// sweeper that forgets clients idle for more than five minutes.
+func initRateLimiter() {
+	if rps, err := getEnvFloat("RATE_LIMIT_RPS"); err != nil {
+		slog.Warn("invalid RATE_LIMIT_RPS, using default", "error", err, "default", rateLimitRPS)
+	} else if rps != nil && *rps > 0 {
+		rateLimitRPS = *rps
+	}
+	rateLimitBurst = getEnvInt("RATE_LIMIT_BURST", rateLimitBurst)
+	if rateLimitBurst < 1 {
+		rateLimitBurst = 1
+	}
+	slog.Info("rate limiting enabled", "rps", rateLimitRPS, "burst", rateLimitBurst)
+	go func() {
+		ticker := time.NewTicker(limiterSweepEvery)
+		defer ticker.Stop()
+		for range ticker.C {
+			evictIdleLimiters(time.Now().Add(-limiterIdleTTL))
+		}
+	}()
+}
+func evictIdleLimiters(cutoff time.Time) {
+	clientLimiters.Range(func(key, value any) bool {
+		cl := value.(*clientLimiter)
+		cl.mu.Lock()
+		idle := cl.lastSeen.Before(cutoff)
+		cl.mu.Unlock()
+		if idle {
+			clientLimiters.Delete(key)
+		}
+		return true
+	})
+}
+func limiterForIP(ip string) *clientLimiter {
+	if v, ok := clientLimiters.Load(ip); ok {
+		return v.(*clientLimiter)
+	}
+	v, _ := clientLimiters.LoadOrStore(ip, &clientLimiter{
+		limiter: rate.NewLimiter(rate.Limit(rateLimitRPS), rateLimitBurst),
+	})
+	return v.(*clientLimiter)
+}
+
+// trustedProxies are the TRUSTED_PROXIES networks whose forwarding headers
+// realIP believes.
+var trustedProxies []*net.IPNet
+
+// loadTrustedProxies reads TRUSTED_PROXIES, a comma-separated list of CIDRs or
+// bare IPs.
+func loadTrustedProxies() {
+	trustedProxies = nil
+	for _, entry := range splitAndTrim(os.Getenv("TRUSTED_PROXIES")) {
+		network, err := parseProxyCIDR(entry)
+		if err != nil {
+			slog.Warn("ignoring invalid TRUSTED_PROXIES entry", "entry", entry, "error", err)
+			continue
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+	if len(trustedProxies) > 0 {
+		slog.Info("trusted proxies loaded", "count", len(trustedProxies))
+	}
+}
+
+// parseProxyCIDR parses a CIDR, treating a bare IP as a single-address network.
+func parseProxyCIDR(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", entry)
+		}
+		bits := 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(entry)
+	return network, err
+}
+
+func isTrustedProxy(ip net.IP, trusted []*net.IPNet) bool {
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP returns the caller's address. Forwarded headers are only believed
+// when the request came from a trusted proxy; with no TRUSTED_PROXIES the host
+// part of r.RemoteAddr is used, so a direct client can't spoof its address.
+// Otherwise X-Forwarded-For is walked right to left past trusted proxies and
+// the first untrusted hop is the client; without it, X-Real-IP is used.
+func realIP(r *http.Request, trusted []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if ip := net.ParseIP(remote); ip == nil || !isTrustedProxy(ip, trusted) {
+		return remote
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				continue
+			}
+			client = hop
+			if !isTrustedProxy(ip, trusted) {
+				break
+			}
+		}
+		if client != "" {
+			return client
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return remote
+}
+
+// rateLimitMiddleware applies a per-IP token bucket and answers 429 with Retry-After
+// once a client exhausts its burst.
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cl := limiterForIP(realIP(r, trustedProxies))
+		cl.mu.Lock()
+		cl.lastSeen = time.Now()
+		cl.mu.Unlock()
+		if !cl.limiter.Allow() {
+			retryAfter := int(math.Ceil(1 / rateLimitRPS))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			respondError(w, r, http.StatusTooManyRequests, APIError{Code: ErrRateLimited, Message: "Too many requests"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
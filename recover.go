@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// panicWebhookTimeout bounds the PANIC_WEBHOOK_URL notification.
+const panicWebhookTimeout = 5 * time.Second
+
+// recoverMiddleware turns a handler panic into a logged 500 instead of a
+// dropped connection. It sits directly inside requestIDMiddleware, so the log
+// line and response carry the request ID, and outside loggingMiddleware, so a
+// panic in logging or CORS is caught too. The panic unwinds past the access
+// log, so the 500 is recorded by the error line logged here. When
+// PANIC_WEBHOOK_URL is set the panic is also POSTed there as JSON so alerting
+// works without an SDK.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				// Deliberate abort; let net/http handle it quietly.
+				panic(rec)
+			}
+			ctx := r.Context()
+			stack := string(debug.Stack())
+			slog.ErrorContext(ctx, "panic serving request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", http.StatusInternalServerError,
+				"panic", fmt.Sprint(rec),
+				"stack", stack,
+			)
+			notifyPanicWebhook(ctx, r, rec, stack)
+			respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Internal server error"})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// notifyPanicWebhook posts the panic to PANIC_WEBHOOK_URL in the background.
+func notifyPanicWebhook(ctx context.Context, r *http.Request, rec any, stack string) {
+	url := os.Getenv("PANIC_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+	payload, _ := json.Marshal(map[string]string{
+		"request_id": requestIDFromContext(ctx),
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"panic":      fmt.Sprint(rec),
+		"stack":      stack,
+		"time":       time.Now().UTC().Format(time.RFC3339),
+	})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), panicWebhookTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			slog.WarnContext(ctx, "panic webhook: invalid URL", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			slog.WarnContext(ctx, "panic webhook: request failed", "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.WarnContext(ctx, "panic webhook: unexpected status", "status", resp.StatusCode)
+		}
+	}()
+}
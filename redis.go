@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisClient is shared state across instances (REDIS_URL). Callers fall back to
+// per-process state when it is nil or unreachable.
+var redisClient *redis.Client
+
+const redisOpTimeout = 2 * time.Second
+
+func initRedis() {
+	rawURL := os.Getenv("REDIS_URL")
+	if rawURL == "" {
+		return
+	}
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		slog.Warn("invalid REDIS_URL, using in-memory caches only", "error", err)
+		return
+	}
+	redisClient = redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		// Keep the client: Redis may come up later, and every call already
+		// falls back on error.
+		slog.Warn("redis unreachable at startup", "error", err)
+		return
+	}
+	slog.Info("redis connected", "addr", opts.Addr)
+}
+
+// sharedTokenGet returns a token cached in Redis under key and when it expires.
+func sharedTokenGet(key string) (string, time.Time, bool) {
+	if redisClient == nil {
+		return "", time.Time{}, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	token, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			slog.Warn("redis token lookup failed, falling back to in-memory cache", "key", key, "error", err)
+		}
+		return "", time.Time{}, false
+	}
+	ttl, err := redisClient.PTTL(ctx, key).Result()
+	if err != nil || token == "" || ttl <= 0 {
+		return "", time.Time{}, false
+	}
+	return token, time.Now().Add(ttl), true
+}
+
+// sharedTokenSet stores token in Redis until 30s before expiry, so no instance
+// picks up a token that is about to lapse.
+func sharedTokenSet(key, token string, expiry time.Time) {
+	if redisClient == nil {
+		return
+	}
+	expireAt := expiry.Add(-30 * time.Second)
+	if !expireAt.After(time.Now()) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, token, 0)
+		pipe.ExpireAt(ctx, key, expireAt)
+		return nil
+	})
+	if err != nil {
+		slog.Warn("redis token store failed", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type requestIDKey struct{}
+
+// requestIDMiddleware assigns each request an ID (reusing a valid incoming
+// X-Request-ID), echoes it in the response, and stores it in the context so
+// slog *Context calls tag their records with request_id.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if _, err := uuid.Parse(id); err != nil {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromContext returns the request ID, or "" outside a request.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
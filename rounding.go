@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Rounding modes: the increment hours are rounded to.
+const (
+	RoundingNone           = "none"
+	RoundingNearestQuarter = "nearest_quarter"
+	RoundingNearestHalf    = "nearest_half"
+	RoundingNearestHour    = "nearest_hour"
+)
+
+// Rounding directions.
+const (
+	RoundingUp      = "up"
+	RoundingDown    = "down"
+	RoundingNearest = "nearest"
+)
+
+// RoundingConfig controls how a day's hours in one column are rounded before
+// they are written to the sheet. The zero value leaves hours unchanged;
+// Direction defaults to nearest.
+type RoundingConfig struct {
+	Mode      string `json:"mode,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+func (cfg RoundingConfig) step() float64 {
+	switch cfg.Mode {
+	case RoundingNearestQuarter:
+		return 0.25
+	case RoundingNearestHalf:
+		return 0.5
+	case RoundingNearestHour:
+		return 1
+	}
+	return 0
+}
+
+func (cfg RoundingConfig) validate() error {
+	switch cfg.Mode {
+	case "", RoundingNone, RoundingNearestQuarter, RoundingNearestHalf, RoundingNearestHour:
+	default:
+		return fmt.Errorf("rounding.mode must be none, nearest_quarter, nearest_half or nearest_hour")
+	}
+	switch cfg.Direction {
+	case "", RoundingUp, RoundingDown, RoundingNearest:
+	default:
+		return fmt.Errorf("rounding.direction must be up, down or nearest")
+	}
+	return nil
+}
+
+// roundHours rounds h to cfg's increment in cfg's direction.
+func roundHours(h float64, cfg RoundingConfig) float64 {
+	step := cfg.step()
+	if step == 0 {
+		return h
+	}
+	// Absorb float noise so 7.999999 hours doesn't round up to 8.25.
+	units := h / step
+	if nearest := math.Round(units); math.Abs(units-nearest) < 1e-9 {
+		units = nearest
+	}
+	switch cfg.Direction {
+	case RoundingUp:
+		units = math.Ceil(units)
+	case RoundingDown:
+		units = math.Floor(units)
+	default:
+		units = math.Round(units)
+	}
+	return units * step
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WorkSchedule is a standard week: the same hours on each working day, booked
+// to DefaultJobCode (or the request's first job when empty).
+type WorkSchedule struct {
+	WorkDays       []time.Weekday
+	HoursPerDay    float64
+	DefaultJobCode string
+	LabourCode     string
+}
+
+// workScheduleFile is a WorkSchedule as written in schedule_templates.json,
+// with weekdays by name.
+type workScheduleFile struct {
+	WorkDays       []string `json:"work_days"`
+	HoursPerDay    float64  `json:"hours_per_day"`
+	DefaultJobCode string   `json:"default_job_code,omitempty"`
+	LabourCode     string   `json:"labour_code,omitempty"`
+}
+
+// scheduleTemplates are loaded from SCHEDULE_TEMPLATES_FILE (default
+// schedule_templates.json), keyed by name ("5x8").
+var scheduleTemplates struct {
+	sync.RWMutex
+	templates map[string]WorkSchedule
+}
+
+func scheduleTemplatesFilePath() string {
+	if path := os.Getenv("SCHEDULE_TEMPLATES_FILE"); path != "" {
+		return path
+	}
+	return "schedule_templates.json"
+}
+
+// loadScheduleTemplates (re)reads the schedule templates file. Like the job
+// list, a missing file means no templates and a malformed one keeps the
+// current set.
+func loadScheduleTemplates() {
+	path := scheduleTemplatesFilePath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("schedule templates file not found, no schedule templates", "path", path)
+		return
+	}
+	if err != nil {
+		slog.Error("could not read schedule templates", "path", path, "error", err)
+		return
+	}
+	var raw map[string]workScheduleFile
+	if err := json.Unmarshal(data, &raw); err != nil {
+		slog.Error("could not parse schedule templates, keeping previous set", "path", path, "error", err)
+		return
+	}
+	templates := make(map[string]WorkSchedule, len(raw))
+	for name, entry := range raw {
+		schedule, err := entry.workSchedule()
+		if err != nil {
+			slog.Error("could not parse schedule templates, keeping previous set", "path", path, "template", name, "error", err)
+			return
+		}
+		templates[name] = schedule
+	}
+	scheduleTemplates.Lock()
+	scheduleTemplates.templates = templates
+	scheduleTemplates.Unlock()
+	slog.Info("schedule templates loaded", "path", path, "templates", len(templates))
+}
+
+func (f workScheduleFile) workSchedule() (WorkSchedule, error) {
+	if f.HoursPerDay <= 0 || f.HoursPerDay > maxDailyHours {
+		return WorkSchedule{}, fmt.Errorf("hours_per_day must be between 0 and %g", maxDailyHours)
+	}
+	if len(f.WorkDays) == 0 {
+		return WorkSchedule{}, errors.New("work_days must not be empty")
+	}
+	schedule := WorkSchedule{HoursPerDay: f.HoursPerDay, DefaultJobCode: f.DefaultJobCode, LabourCode: f.LabourCode}
+	for _, name := range f.WorkDays {
+		day, ok := weekdaysByName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return WorkSchedule{}, fmt.Errorf("unknown weekday %q", name)
+		}
+		schedule.WorkDays = append(schedule.WorkDays, day)
+	}
+	return schedule, nil
+}
+
+// lookupScheduleTemplate returns the named schedule template.
+func lookupScheduleTemplate(name string) (WorkSchedule, bool) {
+	scheduleTemplates.RLock()
+	defer scheduleTemplates.RUnlock()
+	schedule, ok := scheduleTemplates.templates[strings.TrimSpace(name)]
+	return schedule, ok
+}
+
+// scheduleStart is the first day a schedule template fills: week_start_date if
+// given, otherwise the start of the request's pay period.
+func scheduleStart(req TimecardRequest) (time.Time, error) {
+	if req.WeekStartDate != "" {
+		return time.Parse(time.RFC3339, req.WeekStartDate)
+	}
+	anchor, length, err := payPeriodCalendar()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("week_start_date is required: %w", err)
+	}
+	for _, period := range payPeriodsForYear(anchor, length, req.Year) {
+		if period.PayPeriodNum == req.PayPeriodNum {
+			return time.Parse(dateLayout, period.Start)
+		}
+	}
+	return time.Time{}, fmt.Errorf("pay period %d of %d not found", req.PayPeriodNum, req.Year)
+}
+
+// applyScheduleTemplate fills req.Entries with tmpl's hours on each working
+// day of the two weeks starting at scheduleStart, and sets WeekStartDate to
+// match.
+func applyScheduleTemplate(req *TimecardRequest, tmpl WorkSchedule) error {
+	start, err := scheduleStart(*req)
+	if err != nil {
+		return err
+	}
+	jobCode := tmpl.DefaultJobCode
+	if jobCode == "" && len(req.Jobs) > 0 {
+		jobCode = req.Jobs[0].JobNumber
+	}
+	if jobCode == "" {
+		return errors.New("schedule template has no default job code and the request has no jobs")
+	}
+	workDays := map[time.Weekday]bool{}
+	for _, day := range tmpl.WorkDays {
+		workDays[day] = true
+	}
+	req.WeekStartDate = start.Format(time.RFC3339)
+	req.Entries = nil
+	for i := 0; i < 14; i++ {
+		date := start.AddDate(0, 0, i)
+		if !workDays[date.Weekday()] {
+			continue
+		}
+		req.Entries = append(req.Entries, Entry{
+			Date:       date.Format(time.RFC3339),
+			JobNumber:  jobCode,
+			LabourCode: tmpl.LabourCode,
+			Hours:      tmpl.HoursPerDay,
+		})
+	}
+	return nil
+}
+
+// expandScheduleTemplate applies req.ScheduleTemplate when the request has no
+// entries of its own. Unknown templates and unresolvable start dates are
+// reported by validateTimecardRequest, so here they leave req unchanged.
+func expandScheduleTemplate(req *TimecardRequest) {
+	if req.ScheduleTemplate == "" || len(req.Entries) > 0 || len(req.Weeks) > 0 {
+		return
+	}
+	if tmpl, ok := lookupScheduleTemplate(req.ScheduleTemplate); ok {
+		_ = applyScheduleTemplate(req, tmpl)
+	}
+}
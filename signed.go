@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// downloadSigningSecret keys the HMAC on signed download tokens
+// (DOWNLOAD_SIGNING_SECRET). Signed downloads are disabled when it is empty.
+var (
+	downloadSigningSecret []byte
+	downloadURLTTL        = 15 * time.Minute
+)
+
+func loadDownloadSigning() {
+	downloadSigningSecret = []byte(os.Getenv("DOWNLOAD_SIGNING_SECRET"))
+	downloadURLTTL = time.Duration(getEnvInt("DOWNLOAD_URL_TTL_MINUTES", 15)) * time.Minute
+	if len(downloadSigningSecret) == 0 {
+		slog.Info("DOWNLOAD_SIGNING_SECRET not set, signed download URLs disabled")
+	}
+}
+
+func downloadSignature(jobID string, expiry int64) string {
+	mac := hmac.New(sha256.New, downloadSigningSecret)
+	fmt.Fprintf(mac, "%s|%d", jobID, expiry)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedDownloadURL returns a URL for /api/download that is valid until the
+// returned time. The token is base64url("<job_id>|<unix expiry>|<hex hmac>").
+func signedDownloadURL(jobID string) (string, time.Time) {
+	expiresAt := time.Now().Add(downloadURLTTL).UTC().Truncate(time.Second)
+	expiry := expiresAt.Unix()
+	raw := fmt.Sprintf("%s|%d|%s", jobID, expiry, downloadSignature(jobID, expiry))
+	token := base64.RawURLEncoding.EncodeToString([]byte(raw))
+	return fmt.Sprintf("/v%s/api/download?token=%s", apiVersion, url.QueryEscape(token)), expiresAt
+}
+
+// verifyDownloadToken returns the job ID a token grants access to.
+func verifyDownloadToken(token string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("malformed token")
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed token")
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("malformed token")
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(downloadSignature(parts[0], expiry))) {
+		return "", fmt.Errorf("invalid signature")
+	}
+	if time.Now().Unix() > expiry {
+		return "", fmt.Errorf("token expired")
+	}
+	return parts[0], nil
+}
+
+// signFileHandler handles POST /api/files/{id}/sign.
+func signFileHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if len(downloadSigningSecret) == 0 {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: "Signed downloads are not configured"})
+		return
+	}
+	if _, ok := lookupJob(r.Context(), id); !ok {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "File not found"})
+		return
+	}
+	signedURL, expiresAt := signedDownloadURL(id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"url":        signedURL,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
+
+// downloadHandler handles GET /api/download?token=... . The signed token stands
+// in for the API token, so this route is registered without authMiddleware.
+func downloadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	if len(downloadSigningSecret) == 0 {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: "Signed downloads are not configured"})
+		return
+	}
+	id, err := verifyDownloadToken(r.URL.Query().Get("token"))
+	if err != nil {
+		slog.WarnContext(ctx, "rejected download token", "error", err)
+		respondError(w, r, http.StatusForbidden, APIError{Code: ErrInvalidDownloadToken, Message: "Invalid or expired download token"})
+		return
+	}
+	status, ok := loadJob(id)
+	if !ok {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "File not found"})
+		return
+	}
+	serveJobExcel(w, r, status)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// templateSHA256 is the hash of template.xlsx recorded by the startup check.
+var templateSHA256 atomic.Value // string
+
+// StatusResponse is the body of GET /api/status.
+type StatusResponse struct {
+	GoVersion       string     `json:"go_version"`
+	Goroutines      int        `json:"goroutines"`
+	HeapAllocMB     float64    `json:"heap_alloc_mb"`
+	GCRuns          uint32     `json:"gc_runs"`
+	TemplateSHA256  string     `json:"template_sha256"`
+	GraphConfigured bool       `json:"graph_configured"`
+	SMTPConfigured  bool       `json:"smtp_configured"`
+	UptimeSeconds   int64      `json:"uptime_seconds"`
+	LastGenerateAt  *time.Time `json:"last_generate_at"`
+	TotalGenerates  int64      `json:"total_generates"`
+	TotalEmails     int64      `json:"total_emails"`
+}
+
+// statusHandler handles GET /api/status (admin only): runtime and usage
+// figures for operators. Unlike /health it checks no dependencies.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	resp := StatusResponse{
+		GoVersion:   runtime.Version(),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAllocMB: float64(mem.HeapAlloc*10/(1<<20)) / 10,
+		GCRuns:      mem.NumGC,
+		// There is no Microsoft Graph client in this build.
+		GraphConfigured: false,
+		SMTPConfigured:  os.Getenv("SMTP_HOST") != "" && os.Getenv("SMTP_PORT") != "",
+		UptimeSeconds:   int64(time.Since(startTime).Seconds()),
+		TotalGenerates:  totalGenerates.Load(),
+		TotalEmails:     totalEmails.Load(),
+	}
+	if sha, ok := templateSHA256.Load().(string); ok {
+		resp.TemplateSHA256 = sha
+	}
+	if nanos := lastGenerateAt.Load(); nanos != 0 {
+		at := time.Unix(0, nanos).UTC().Truncate(time.Second)
+		resp.LastGenerateAt = &at
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+const (
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	pdfContentType  = "application/pdf"
+)
+
+// Generated-file storage. With STORAGE_BACKEND=local (the default) files are
+// streamed back in the response. With s3 they are uploaded to S3_BUCKET and the
+// response carries presigned URLs instead.
+var (
+	storageBackend       = "local"
+	s3Bucket             string
+	s3Client             *s3.Client
+	s3Presigner          *s3.PresignClient
+	presignedURLTTL      = 60 * time.Minute
+	storageUploadTimeout = 30 * time.Second
+)
+
+func initStorage(ctx context.Context) {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND")))
+	switch backend {
+	case "", "local":
+		return
+	case "s3":
+	case "gcs":
+		slog.Warn("storage: gcs backend is not supported yet, using local storage")
+		return
+	default:
+		slog.Warn("storage: unknown STORAGE_BACKEND, using local storage", "value", backend)
+		return
+	}
+	s3Bucket = os.Getenv("S3_BUCKET")
+	if s3Bucket == "" {
+		slog.Warn("storage: STORAGE_BACKEND=s3 but S3_BUCKET is not set, using local storage")
+		return
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		slog.Warn("storage: could not load AWS config, using local storage", "error", err)
+		return
+	}
+	s3Client = s3.NewFromConfig(cfg)
+	s3Presigner = s3.NewPresignClient(s3Client)
+	presignedURLTTL = time.Duration(getEnvInt("PRESIGNED_URL_TTL_MINUTES", 60)) * time.Minute
+	storageBackend = "s3"
+	slog.Info("storage: using s3", "bucket", s3Bucket, "presigned_url_ttl", presignedURLTTL.String())
+}
+
+// timecardStorageKey returns timecards/<year>/<pp>/<employee>/<uuid>.<ext>.
+func timecardStorageKey(req TimecardRequest, ext string) string {
+	year := req.Year
+	if year == 0 {
+		year = time.Now().Year()
+	}
+	return fmt.Sprintf("timecards/%d/%d/%s/%s.%s", year, req.PayPeriodNum, sanitizeFilename(req.EmployeeName), uuid.New().String(), ext)
+}
+
+// storeGeneratedFile uploads data to the remote backend and returns a presigned
+// download URL. It returns false when storage is local or the upload fails, in
+// which case the caller streams the file itself.
+func storeGeneratedFile(ctx context.Context, key string, data []byte, contentType string) (string, bool) {
+	if storageBackend != "s3" {
+		return "", false
+	}
+	uploadCtx, cancel := context.WithTimeout(ctx, storageUploadTimeout)
+	defer cancel()
+	_, err := s3Client.PutObject(uploadCtx, &s3.PutObjectInput{
+		Bucket:      aws.String(s3Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "storage: s3 upload failed, falling back to local", "key", key, "error", err)
+		return "", false
+	}
+	presigned, err := s3Presigner.PresignGetObject(uploadCtx, &s3.GetObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(presignedURLTTL))
+	if err != nil {
+		slog.WarnContext(ctx, "storage: could not presign s3 URL, falling back to local", "key", key, "error", err)
+		return "", false
+	}
+	slog.InfoContext(ctx, "storage: uploaded to s3", "key", key, "bytes", len(data))
+	return presigned.URL, true
+}
+
+// writeTimecardFile sends a generated timecard: a JSON body with a presigned URL
+// when remote storage is enabled, otherwise the file as an attachment. It returns
+// the storage key, or "" when the file was streamed.
+func writeTimecardFile(w http.ResponseWriter, r *http.Request, req TimecardRequest, data []byte, ext, contentType string) string {
+	key := timecardStorageKey(req, ext)
+	if url, ok := storeGeneratedFile(r.Context(), key, data, contentType); ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok", storageURLField(ext): url})
+		return key
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", attachmentDisposition("timecard_"+req.EmployeeName+"."+ext))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+	return ""
+}
+
+func storageURLField(ext string) string {
+	if ext == "pdf" {
+		return "pdf_url"
+	}
+	return "excel_url"
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// templateConfigCells are the cells fillWeekSheet writes header values into.
+var templateConfigCells = []string{"M2", "AJ2", "B4"}
+
+// TemplateInfo describes the structure of the timecard template.
+type TemplateInfo struct {
+	Path         string              `json:"path"`
+	SHA256       string              `json:"sha256"`
+	Sheets       []TemplateSheetInfo `json:"sheets"`
+	DefinedNames []TemplateName      `json:"defined_names"`
+}
+
+type TemplateSheetInfo struct {
+	Name        string            `json:"name"`
+	MergedCells []string          `json:"merged_cells"`
+	HeaderRow   int               `json:"header_row"`
+	Headers     map[string]string `json:"headers"`
+	ConfigCells map[string]string `json:"config_cells"`
+}
+
+type TemplateName struct {
+	Name     string `json:"name"`
+	RefersTo string `json:"refers_to"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// templateInfoHandler handles GET /api/template-info (admin only). It reports
+// what the server expects to find in the template so a template update can be
+// checked without opening Excel.
+func templateInfoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	path := tenantFromContext(ctx).timecardTemplatePath()
+	info, err := readTemplateInfo(path)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not read template info", "path", path, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrTemplateNotFound, Message: fmt.Sprintf("Error reading template: %v", err)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func readTemplateInfo(path string) (*TemplateInfo, error) {
+	data, err := readTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := &TemplateInfo{
+		Path:         path,
+		SHA256:       fmt.Sprintf("%x", sha256.Sum256(data)),
+		DefinedNames: []TemplateName{},
+	}
+	for _, dn := range f.GetDefinedName() {
+		info.DefinedNames = append(info.DefinedNames, TemplateName{Name: dn.Name, RefersTo: dn.RefersTo, Scope: dn.Scope})
+	}
+	headerRow := sheetLayout.RegularHeaderRow
+	for _, sheet := range f.GetSheetList() {
+		sheetInfo := TemplateSheetInfo{
+			Name:        sheet,
+			MergedCells: []string{},
+			HeaderRow:   headerRow,
+			Headers:     map[string]string{},
+			ConfigCells: map[string]string{},
+		}
+		merged, err := f.GetMergeCells(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", sheet, err)
+		}
+		for _, mc := range merged {
+			sheetInfo.MergedCells = append(sheetInfo.MergedCells, mc.GetStartAxis()+":"+mc.GetEndAxis())
+		}
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", sheet, err)
+		}
+		if len(rows) >= headerRow {
+			for i, value := range rows[headerRow-1] {
+				if value == "" {
+					continue
+				}
+				col, _ := excelize.ColumnNumberToName(i + 1)
+				sheetInfo.Headers[col] = value
+			}
+		}
+		for _, cell := range templateConfigCells {
+			value, _ := f.GetCellValue(sheet, cell)
+			sheetInfo.ConfigCells[cell] = value
+		}
+		info.Sheets = append(info.Sheets, sheetInfo)
+	}
+	return info, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// embeddedTemplates are the workbook templates built into the binary, used
+// when TemplateDir has no copy of its own.
+//
+//go:embed template.xlsx expense_mileage_template.xlsx
+var embeddedTemplates embed.FS
+
+// xlsxMagic starts every OOXML workbook: they are ZIP archives.
+var xlsxMagic = []byte("PK\x03\x04")
+
+// cachedTemplate holds one template's bytes once they have been read.
+type cachedTemplate struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// templateCache maps template path -> *cachedTemplate. Entries live until
+// resetTemplateCache; failed reads are dropped so they are retried.
+var templateCache sync.Map
+
+// readTemplate returns the workbook template at path, reading it only on
+// first use. Callers must not modify the returned bytes.
+func readTemplate(path string) ([]byte, error) {
+	v, _ := templateCache.LoadOrStore(path, &cachedTemplate{})
+	t := v.(*cachedTemplate)
+	t.once.Do(func() { t.data, t.err = loadTemplate(path) })
+	if t.err != nil {
+		templateCache.CompareAndDelete(path, t)
+	}
+	return t.data, t.err
+}
+
+// resetTemplateCache makes the next readTemplate of every template go back to
+// disk, picking up templates replaced since they were first read.
+func resetTemplateCache() {
+	templateCache.Range(func(key, _ any) bool {
+		templateCache.Delete(key)
+		return true
+	})
+}
+
+// loadTemplate reads the workbook template at path. A default template
+// (templateFile(name)) that isn't on disk comes from embeddedTemplates; a
+// tenant's own template path must exist.
+func loadTemplate(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		name := filepath.Base(path)
+		if path == templateFile(name) {
+			data, err = embeddedTemplates.ReadFile(name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, xlsxMagic) {
+		return nil, fmt.Errorf("%s is not an .xlsx workbook", path)
+	}
+	return data, nil
+}
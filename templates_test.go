@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmbeddedTemplatesAreWorkbooks(t *testing.T) {
+	for _, name := range []string{"template.xlsx", "expense_mileage_template.xlsx"} {
+		data, err := embeddedTemplates.ReadFile(name)
+		if err != nil {
+			t.Fatalf("%s is not embedded: %v", name, err)
+		}
+		if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+			t.Errorf("%s does not start with the ZIP magic bytes", name)
+		}
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	defer func(old string) { templateDir = old }(templateDir)
+	templateDir = t.TempDir()
+	notWorkbook := filepath.Join(templateDir, "tenant.xlsx")
+	if err := os.WriteFile(notWorkbook, []byte("not a workbook"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "default template falls back to the embedded copy", path: templateFile("template.xlsx")},
+		{name: "missing tenant template", path: filepath.Join(templateDir, "missing.xlsx"), wantErr: true},
+		{name: "tenant template that is not a workbook", path: notWorkbook, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := loadTemplate(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("loadTemplate succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadTemplate: %v", err)
+			}
+			if !bytes.HasPrefix(data, xlsxMagic) {
+				t.Error("loaded template is not a workbook")
+			}
+		})
+	}
+}
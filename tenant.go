@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TenantConfig is one tenant's settings, loaded from tenants/<id>/config.json.
+// Empty fields fall back to the server-wide defaults.
+type TenantConfig struct {
+	ID           string            `json:"-" yaml:"-"`
+	TemplatePath string            `json:"template_path,omitempty" yaml:"template_path"`
+	Jobs         []Job             `json:"jobs,omitempty" yaml:"jobs"`
+	SMTP         *TenantSMTPConfig `json:"smtp,omitempty" yaml:"smtp"`
+}
+
+// TenantSMTPConfig overrides the SMTP_* env vars for one tenant.
+type TenantSMTPConfig struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     string `json:"port" yaml:"port"`
+	User     string `json:"user" yaml:"user"`
+	Pass     string `json:"pass" yaml:"pass"`
+	From     string `json:"from,omitempty" yaml:"from"`
+	FromName string `json:"from_name,omitempty" yaml:"from_name"`
+}
+
+// timecardTemplatePath returns the tenant's workbook template, or the default.
+func (t *TenantConfig) timecardTemplatePath() string {
+	if t != nil && t.TemplatePath != "" {
+		return t.TemplatePath
+	}
+	return templateFile("template.xlsx")
+}
+
+// tenantConfigs maps tenant ID -> *TenantConfig, from TENANTS_DIR and the
+// config file. Multi-tenancy is on when at least one tenant is configured;
+// otherwise requests need no X-Tenant-ID.
+var (
+	tenantConfigs sync.Map
+	tenantsLoaded bool
+)
+
+type tenantKey struct{}
+
+// loadTenants reads every TENANTS_DIR/<id>/config.json (default dir "tenants").
+// Template paths are resolved relative to the tenant's directory.
+func loadTenants() {
+	dir := os.Getenv("TENANTS_DIR")
+	if dir == "" {
+		dir = "tenants"
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		tenantDir := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(tenantDir, "config.json"))
+		if err != nil {
+			continue
+		}
+		cfg := &TenantConfig{}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			slog.Error("invalid tenant config, skipping tenant", "tenant_id", entry.Name(), "error", err)
+			continue
+		}
+		cfg.ID = entry.Name()
+		if cfg.TemplatePath != "" && !filepath.IsAbs(cfg.TemplatePath) {
+			// A relative template must stay inside the tenant's directory.
+			if cfg.TemplatePath, err = joinWithin(tenantDir, cfg.TemplatePath); err != nil {
+				slog.Error("invalid tenant template_path, skipping tenant", "tenant_id", entry.Name(), "error", err)
+				continue
+			}
+		}
+		tenantConfigs.Store(cfg.ID, cfg)
+		count++
+	}
+	if count > 0 {
+		tenantsLoaded = true
+		slog.Info("multi-tenant mode enabled", "dir", dir, "tenants", count)
+	}
+}
+
+// tenantMiddleware resolves X-Tenant-ID to a TenantConfig and stores it in the
+// request context. In multi-tenant mode a missing or unknown tenant is a 400.
+func tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tenantsLoaded || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := r.Header.Get("X-Tenant-ID")
+		value, ok := tenantConfigs.Load(id)
+		if id == "" || !ok {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrUnknownTenant, Message: "Unknown or missing X-Tenant-ID"})
+			return
+		}
+		ctx := context.WithValue(r.Context(), tenantKey{}, value.(*TenantConfig))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tenantFromContext returns the request's tenant, or nil in single-tenant mode.
+func tenantFromContext(ctx context.Context) *TenantConfig {
+	tenant, _ := ctx.Value(tenantKey{}).(*TenantConfig)
+	return tenant
+}
+
+// tenantIDFromContext returns the request's tenant ID, or "" in single-tenant
+// mode. Jobs, email records and stored timecards are tagged with it and only
+// visible to requests from the same tenant. X-Tenant-ID is not tied to the
+// bearer token, so this keeps tenants apart but does not stop a caller from
+// naming another tenant.
+func tenantIDFromContext(ctx context.Context) string {
+	if tenant := tenantFromContext(ctx); tenant != nil {
+		return tenant.ID
+	}
+	return ""
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// timecardDB stores generated timecard metadata (DATABASE_URL). History is off
+// when nil.
+var timecardDB *sql.DB
+
+const timecardSchema = `CREATE TABLE IF NOT EXISTS timecards (
+	id UUID PRIMARY KEY,
+	employee_name TEXT NOT NULL,
+	pay_period INT NOT NULL,
+	year INT NOT NULL,
+	file_key TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	revision INT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS timecards_employee_year ON timecards (employee_name, year, pay_period);
+ALTER TABLE timecards ADD COLUMN IF NOT EXISTS approved_at TIMESTAMPTZ;
+ALTER TABLE timecards ADD COLUMN IF NOT EXISTS request JSONB;
+ALTER TABLE timecards ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS timecards_revision;
+CREATE UNIQUE INDEX IF NOT EXISTS timecards_tenant_revision ON timecards (tenant_id, employee_name, year, pay_period, revision)`
+
+func initTimecardDB() {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		return
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		slog.Error("timecard db: could not open database", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, timecardSchema); err != nil {
+		slog.Error("timecard db: could not create schema", "error", err)
+		db.Close()
+		return
+	}
+	timecardDB = db
+	slog.Info("timecard history enabled")
+}
+
+// TimecardRecord is one stored generation of a timecard. Each regeneration for
+// the same tenant, employee, pay period and year adds a row with the next
+// revision. Rows are only visible to requests from the tenant that made them.
+type TimecardRecord struct {
+	ID           string     `json:"id"`
+	EmployeeName string     `json:"employee_name"`
+	PayPeriod    int        `json:"pay_period"`
+	Year         int        `json:"year"`
+	FileKey      string     `json:"file_key,omitempty"`
+	Revision     int        `json:"revision"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ApprovedAt   *time.Time `json:"approved_at,omitempty"`
+}
+
+// maxRevisionAttempts bounds how often recordTimecard retries after losing a
+// race for the next revision number.
+const maxRevisionAttempts = 5
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// recordTimecard stores a successful generation. fileKey is the storage key when
+// the file was uploaded, or "" when it was only streamed to the client. The
+// request is kept (without logo and webhook secret) for exports like iCal.
+func recordTimecard(ctx context.Context, req TimecardRequest, fileKey string) {
+	if timecardDB == nil {
+		return
+	}
+	stored := req
+	stored.CompanyLogoBase64 = nil
+	stored.WebhookSecret = ""
+	requestJSON, err := json.Marshal(stored)
+	if err != nil {
+		slog.WarnContext(ctx, "timecard db: could not encode request", "error", err)
+		requestJSON = nil
+	}
+	// Two concurrent generations can pick the same next revision; the unique
+	// index rejects the second, which then retries with a fresh MAX.
+	var revision int
+	for attempt := 1; ; attempt++ {
+		err = timecardDB.QueryRowContext(context.WithoutCancel(ctx),
+			`INSERT INTO timecards (id, employee_name, pay_period, year, file_key, created_at, revision, request, tenant_id)
+			 SELECT $1, $2, $3, $4, NULLIF($5, ''), NOW(), COALESCE(MAX(revision), 0) + 1, $6, $7
+			 FROM timecards WHERE tenant_id = $7 AND employee_name = $2 AND pay_period = $3 AND year = $4
+			 RETURNING revision`,
+			uuid.New().String(), req.EmployeeName, req.PayPeriodNum, req.Year, fileKey, requestJSON, tenantIDFromContext(ctx),
+		).Scan(&revision)
+		if attempt == maxRevisionAttempts || !isUniqueViolation(err) {
+			break
+		}
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "timecard db: insert failed", "employee_name", req.EmployeeName, "error", err)
+		return
+	}
+	slog.DebugContext(ctx, "timecard db: recorded generation",
+		"employee_name", req.EmployeeName,
+		"pay_period", req.PayPeriodNum,
+		"revision", revision,
+	)
+}
+
+// timecardsHandler handles GET /api/timecards?employee_name=&year=.
+func timecardsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	if timecardDB == nil {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: "Timecard history is not enabled"})
+		return
+	}
+	q := r.URL.Query()
+	employeeName := q.Get("employee_name")
+	if employeeName == "" {
+		respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: employee_name is required"})
+		return
+	}
+	query := `SELECT id, employee_name, pay_period, year, COALESCE(file_key, ''), revision, created_at, approved_at
+		FROM timecards WHERE tenant_id = $1 AND employee_name = $2`
+	args := []any{tenantIDFromContext(ctx), employeeName}
+	if v := q.Get("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, APIError{Code: ErrInvalidRequest, Message: "Invalid request: year must be a number"})
+			return
+		}
+		query += " AND year = $3"
+		args = append(args, year)
+	}
+	query += " ORDER BY year DESC, pay_period DESC, revision DESC"
+	rows, err := timecardDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "timecard db: query failed", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading timecards"})
+		return
+	}
+	defer rows.Close()
+	records := []TimecardRecord{}
+	for rows.Next() {
+		var rec TimecardRecord
+		var approvedAt sql.NullTime
+		if err := rows.Scan(&rec.ID, &rec.EmployeeName, &rec.PayPeriod, &rec.Year, &rec.FileKey, &rec.Revision, &rec.CreatedAt, &approvedAt); err != nil {
+			slog.ErrorContext(ctx, "timecard db: scan failed", "error", err)
+			respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading timecards"})
+			return
+		}
+		if approvedAt.Valid {
+			rec.ApprovedAt = &approvedAt.Time
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "timecard db: query failed", "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading timecards"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// timecardApproval returns when the employee's timecard for req's pay period was
+// approved, or nil if it hasn't been (or history is off). Approved timecards are
+// immutable until rejected.
+func timecardApproval(ctx context.Context, req TimecardRequest) (*time.Time, error) {
+	if timecardDB == nil {
+		return nil, nil
+	}
+	var approvedAt sql.NullTime
+	err := timecardDB.QueryRowContext(ctx,
+		`SELECT MAX(approved_at) FROM timecards WHERE tenant_id = $1 AND employee_name = $2 AND pay_period = $3 AND year = $4`,
+		tenantIDFromContext(ctx), req.EmployeeName, req.PayPeriodNum, req.Year,
+	).Scan(&approvedAt)
+	if err != nil || !approvedAt.Valid {
+		return nil, err
+	}
+	return &approvedAt.Time, nil
+}
+
+// rejectTimecardRequest is the optional body of POST /api/timecards/{id}/reject.
+// When employee_email is set the employee is told the timecard needs changes.
+type rejectTimecardRequest struct {
+	EmployeeEmail string `json:"employee_email,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// timecardIDFromPath returns the {id} of a /api/timecards/{id}/... route. It
+// answers 503 or 404 itself when history is disabled or the ID is malformed.
+func timecardIDFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if timecardDB == nil {
+		respondError(w, r, http.StatusServiceUnavailable, APIError{Code: ErrNotEnabled, Message: "Timecard history is not enabled"})
+		return "", false
+	}
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "Timecard not found"})
+		return "", false
+	}
+	return id, true
+}
+
+// loadTimecardRecord looks up the timecard named in the path for approve and
+// reject.
+func loadTimecardRecord(w http.ResponseWriter, r *http.Request) (TimecardRecord, bool) {
+	ctx := r.Context()
+	var rec TimecardRecord
+	id, ok := timecardIDFromPath(w, r)
+	if !ok {
+		return rec, false
+	}
+	err := timecardDB.QueryRowContext(ctx,
+		`SELECT id, employee_name, pay_period, year FROM timecards WHERE id = $1 AND tenant_id = $2`, id, tenantIDFromContext(ctx),
+	).Scan(&rec.ID, &rec.EmployeeName, &rec.PayPeriod, &rec.Year)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, APIError{Code: ErrNotFound, Message: "Timecard not found"})
+		return rec, false
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "timecard db: lookup failed", "timecard_id", id, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error reading timecard"})
+		return rec, false
+	}
+	return rec, true
+}
+
+// approveTimecardHandler handles POST /api/timecards/{id}/approve.
+func approveTimecardHandler(w http.ResponseWriter, r *http.Request) {
+	if rec, ok := loadTimecardRecord(w, r); ok {
+		approveTimecard(w, r, rec)
+	}
+}
+
+// rejectTimecardHandler handles POST /api/timecards/{id}/reject.
+func rejectTimecardHandler(w http.ResponseWriter, r *http.Request) {
+	if rec, ok := loadTimecardRecord(w, r); ok {
+		rejectTimecard(w, r, rec)
+	}
+}
+
+func approveTimecard(w http.ResponseWriter, r *http.Request, rec TimecardRecord) {
+	ctx := r.Context()
+	var approvedAt time.Time
+	err := timecardDB.QueryRowContext(ctx,
+		`UPDATE timecards SET approved_at = COALESCE(approved_at, NOW()) WHERE id = $1 RETURNING approved_at`, rec.ID,
+	).Scan(&approvedAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "timecard db: approve failed", "timecard_id", rec.ID, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error approving timecard"})
+		return
+	}
+	rec.ApprovedAt = &approvedAt
+	slog.InfoContext(ctx, "timecard approved", "timecard_id", rec.ID, "employee_name", rec.EmployeeName, "pay_period", rec.PayPeriod)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// rejectTimecard clears approval on every revision of the timecard so it can be
+// regenerated.
+func rejectTimecard(w http.ResponseWriter, r *http.Request, rec TimecardRecord) {
+	ctx := r.Context()
+	var body rejectTimecardRequest
+	if r.ContentLength != 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+			return
+		}
+	}
+	_, err := timecardDB.ExecContext(ctx,
+		`UPDATE timecards SET approved_at = NULL WHERE tenant_id = $1 AND employee_name = $2 AND pay_period = $3 AND year = $4`,
+		tenantIDFromContext(ctx), rec.EmployeeName, rec.PayPeriod, rec.Year,
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "timecard db: reject failed", "timecard_id", rec.ID, "error", err)
+		respondError(w, r, http.StatusInternalServerError, APIError{Code: ErrInternal, Message: "Error rejecting timecard"})
+		return
+	}
+	slog.InfoContext(ctx, "timecard rejected", "timecard_id", rec.ID, "employee_name", rec.EmployeeName, "pay_period", rec.PayPeriod)
+	notified := false
+	if to := strings.TrimSpace(body.EmployeeEmail); to != "" {
+		subject := fmt.Sprintf("Timecard for pay period %d needs changes", rec.PayPeriod)
+		message := fmt.Sprintf("Hi %s,\n\nYour timecard for pay period %d, %d was rejected and needs to be resubmitted.\n",
+			rec.EmployeeName, rec.PayPeriod, rec.Year)
+		if body.Reason != "" {
+			message += "\nReason: " + body.Reason + "\n"
+		}
+		if err := sendEmail(ctx, tenantFromContext(ctx), to, nil, "", subject, message, nil, rec.EmployeeName); err != nil {
+			slog.WarnContext(ctx, "could not send rejection email", "timecard_id", rec.ID, "error", err)
+		} else {
+			notified = true
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"id": rec.ID, "status": "rejected", "employee_notified": notified})
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validation codes reported in ValidationError.Code, alongside ErrInvalidDate
+// and ErrNoEntries.
+const (
+	ValidationRequired         = "required"
+	ValidationInvalidYear      = "invalid_year"
+	ValidationInvalidPayPeriod = "invalid_pay_period"
+	ValidationNegativeHours    = "negative_hours"
+	ValidationInvalidHours     = "invalid_hours"
+	ValidationDuplicateJob     = "duplicate_job"
+	ValidationDailyCapExceeded = "daily_cap_exceeded"
+	ValidationInvalidStartHour = "invalid_start_hour"
+	ValidationUnknownSchedule  = "unknown_schedule_template"
+	ValidationInvalidRounding  = "invalid_rounding"
+	ValidationPasswordTooLong  = "password_too_long"
+	ValidationInvalidColor     = "invalid_color"
+	ValidationInvalidWeekStart = "invalid_week_start_day"
+	ValidationShiftPastWeek    = "shift_past_week"
+)
+
+const (
+	minTimecardYear = 2000
+	maxTimecardYear = 2100
+	maxDailyHours   = 24.0
+	// maxSheetPasswordLength is Excel's limit.
+	maxSheetPasswordLength = 255
+)
+
+// hexColorPattern matches an RGB color for job_colors, with or without "#".
+var hexColorPattern = regexp.MustCompile(`^#?[0-9A-Fa-f]{6}$`)
+
+// ValidationError is one problem found in a TimecardRequest.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// validateTimecardRequest checks a request before any workbook is built and
+// returns every problem found, not just the first.
+func validateTimecardRequest(req TimecardRequest) []ValidationError {
+	var errs []ValidationError
+	add := func(field, code, format string, args ...any) {
+		errs = append(errs, ValidationError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	if strings.TrimSpace(req.EmployeeName) == "" {
+		add("employee_name", ValidationRequired, "employee_name is required")
+	}
+	if req.Year < minTimecardYear || req.Year > maxTimecardYear {
+		add("year", ValidationInvalidYear, "year must be between %d and %d", minTimecardYear, maxTimecardYear)
+	}
+	if maxPeriod := maxPayPeriodNum(); req.PayPeriodNum < 1 || req.PayPeriodNum > maxPeriod {
+		add("pay_period_num", ValidationInvalidPayPeriod, "pay_period_num must be between 1 and %d", maxPeriod)
+	}
+	if req.WeekStartDate != "" {
+		if _, err := time.Parse(time.RFC3339, req.WeekStartDate); err != nil {
+			add("week_start_date", ErrInvalidDate, "week_start_date %q is not RFC 3339", req.WeekStartDate)
+		}
+	}
+	switch strings.ToLower(req.WeekStartDay) {
+	case "", "sunday", "monday":
+	default:
+		add("week_start_day", ValidationInvalidWeekStart, "week_start_day must be sunday or monday, got %q", req.WeekStartDay)
+	}
+	if err := req.Rounding.validate(); err != nil {
+		add("rounding", ValidationInvalidRounding, "%v", err)
+	}
+	colored := make([]string, 0, len(req.JobColors))
+	for jobNumber := range req.JobColors {
+		colored = append(colored, jobNumber)
+	}
+	sort.Strings(colored)
+	for _, jobNumber := range colored {
+		if color := req.JobColors[jobNumber]; !hexColorPattern.MatchString(color) {
+			add(fmt.Sprintf("job_colors.%s", jobNumber), ValidationInvalidColor, "job color %q must be six hex digits, e.g. FF6B6B", color)
+		}
+	}
+	if n := utf8.RuneCountInString(req.ExcelSheetPassword); n > maxSheetPasswordLength {
+		add("excel_sheet_password", ValidationPasswordTooLong, "excel_sheet_password must be at most %d characters, got %d", maxSheetPasswordLength, n)
+	}
+
+	seenJobs := make(map[string]bool, len(req.Jobs))
+	for i, job := range req.Jobs {
+		if seenJobs[job.JobNumber] {
+			add(fmt.Sprintf("jobs[%d].job_number", i), ValidationDuplicateJob, "job %q is listed more than once", job.JobNumber)
+		}
+		seenJobs[job.JobNumber] = true
+	}
+
+	dailyHours := map[string]float64{}
+	total := 0
+	checkEntries := func(prefix string, entries []Entry) {
+		for i, entry := range entries {
+			total++
+			field := fmt.Sprintf("%s[%d]", prefix, i)
+			_, err := time.Parse(time.RFC3339, entry.Date)
+			if err != nil {
+				add(field+".date", ErrInvalidDate, "date %q is not RFC 3339", entry.Date)
+			}
+			// Every comparison with NaN is false, so it would slip past the checks
+			// below; rule it and ±Inf out first.
+			finite := !math.IsNaN(entry.Hours) && !math.IsInf(entry.Hours, 0)
+			if !finite {
+				add(field+".hours", ValidationInvalidHours, "hours must be a finite number")
+			} else if entry.Hours < 0 {
+				add(field+".hours", ValidationNegativeHours, "hours must not be negative")
+			}
+			if entry.NightShiftStartHour < 0 || entry.NightShiftStartHour > 23 {
+				add(field+".night_shift_start_hour", ValidationInvalidStartHour, "night_shift_start_hour must be between 0 and 23")
+			}
+			if err != nil || !finite || entry.Hours <= 0 {
+				continue
+			}
+			// A night shift past midnight counts towards both days.
+			parts := []Entry{entry}
+			if first, second, ok := splitMidnightEntry(entry); ok {
+				parts = []Entry{first, second}
+			}
+			for _, part := range parts {
+				partDate, _ := time.Parse(time.RFC3339, part.Date)
+				day := partDate.Format(dateLayout)
+				before := dailyHours[day]
+				dailyHours[day] = before + part.Hours
+				if before <= maxDailyHours && dailyHours[day] > maxDailyHours {
+					add(field+".hours", ValidationDailyCapExceeded, "more than %g hours logged on %s", maxDailyHours, day)
+				}
+			}
+		}
+	}
+	checkEntries("entries", req.Entries)
+	for i, week := range req.Weeks {
+		if week.WeekStartDate != "" {
+			if _, err := time.Parse(time.RFC3339, week.WeekStartDate); err != nil {
+				add(fmt.Sprintf("weeks[%d].week_start_date", i), ErrInvalidDate, "week_start_date %q is not RFC 3339", week.WeekStartDate)
+			}
+		}
+		checkEntries(fmt.Sprintf("weeks[%d].entries", i), week.Entries)
+	}
+	if len(errs) == 0 {
+		// The after-midnight half of a night shift needs a week to land in, or
+		// fillWeekSheet has no row for it and the hours are lost.
+		var starts []time.Time
+		for _, week := range timecardWeeks(req) {
+			start, _ := time.Parse(time.RFC3339, week.WeekStartDate)
+			starts = append(starts, start)
+		}
+		checkMidnight := func(prefix string, entries []Entry) {
+			for i, entry := range entries {
+				first, second, ok := splitMidnightEntry(entry)
+				if !ok {
+					continue
+				}
+				firstDate, _ := time.Parse(time.RFC3339, first.Date)
+				secondDate, _ := time.Parse(time.RFC3339, second.Date)
+				if weekIndex(starts, firstDate) >= 0 && weekIndex(starts, secondDate) < 0 {
+					add(fmt.Sprintf("%s[%d].hours", prefix, i), ValidationShiftPastWeek, "night shift runs past midnight into %s, which is outside the timecard's weeks", secondDate.Format(dateLayout))
+				}
+			}
+		}
+		checkMidnight("entries", req.Entries)
+		for i, week := range req.Weeks {
+			checkMidnight(fmt.Sprintf("weeks[%d].entries", i), week.Entries)
+		}
+	}
+	if total == 0 && req.ScheduleTemplate != "" {
+		if tmpl, ok := lookupScheduleTemplate(req.ScheduleTemplate); !ok {
+			add("schedule_template", ValidationUnknownSchedule, "schedule template %q is not defined", req.ScheduleTemplate)
+		} else if err := applyScheduleTemplate(&req, tmpl); err != nil {
+			add("schedule_template", ValidationRequired, "%v", err)
+		}
+		total = len(req.Entries)
+	}
+	if total == 0 {
+		add("entries", ErrNoEntries, "at least one entry is required")
+	}
+	return errs
+}
+
+// maxPayPeriodNum is the highest pay period number a year can have with
+// PAY_PERIOD_LENGTH_DAYS periods.
+func maxPayPeriodNum() int {
+	length := getEnvInt("PAY_PERIOD_LENGTH_DAYS", 14)
+	if length < 1 {
+		length = 14
+	}
+	return 366/length + 1
+}
+
+// respondValidationErrors writes errs as a single 422 response.
+func respondValidationErrors(w http.ResponseWriter, r *http.Request, errs []ValidationError) {
+	slog.InfoContext(r.Context(), "request failed validation", "errors", len(errs), "first_field", errs[0].Field)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{"errors": errs})
+}
+
+// TimecardPreview is the /api/validate-timecard response: the validation
+// result plus the hours the workbook would contain.
+type TimecardPreview struct {
+	Valid         bool              `json:"valid"`
+	Errors        []ValidationError `json:"errors"`
+	Warnings      []string          `json:"warnings"`
+	ComputedWeeks []WeekPreview     `json:"computed_weeks"`
+}
+
+// WeekPreview totals one week's hours per job.
+type WeekPreview struct {
+	WeekNumber    int          `json:"week_number"`
+	WeekLabel     string       `json:"week_label"`
+	WeekStartDate string       `json:"week_start_date"`
+	Jobs          []JobPreview `json:"jobs"`
+}
+
+// JobPreview is one job's hours within a week.
+type JobPreview struct {
+	JobNumber     string  `json:"job_number"`
+	JobName       string  `json:"job_name,omitempty"`
+	RegularHours  float64 `json:"regular_hours"`
+	OvertimeHours float64 `json:"overtime_hours"`
+	NightHours    float64 `json:"night_hours"`
+	TotalHours    float64 `json:"total_hours"`
+}
+
+// validateTimecardPreviewHandler handles POST /api/validate-timecard: it runs
+// validation and the same week split and hour bucketing as generation, without
+// building a file. It always answers 200; "valid" says whether generate would
+// accept the request.
+func validateTimecardPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	var req TimecardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		slog.WarnContext(ctx, "error decoding request", "error", err)
+		respondError(w, r, decodeErrorStatus(err), APIError{Code: decodeErrorCode(err), Message: fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if len(req.Jobs) == 0 {
+		if tenant := tenantFromContext(ctx); tenant != nil {
+			req.Jobs = tenant.Jobs
+		}
+	}
+	if len(req.Jobs) == 0 {
+		req.Jobs = defaultJobs()
+	}
+	preview := previewTimecard(req)
+	slog.InfoContext(ctx, "validated timecard",
+		"employee_name", req.EmployeeName,
+		"valid", preview.Valid,
+		"errors", len(preview.Errors),
+		"warnings", len(preview.Warnings),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// previewTimecard validates req and totals its hours per week and job the way
+// fillWeekSheet lays them out, warning about anything the workbook would drop.
+func previewTimecard(req TimecardRequest) TimecardPreview {
+	errs := validateTimecardRequest(req)
+	preview := TimecardPreview{
+		Valid:         len(errs) == 0,
+		Errors:        errs,
+		Warnings:      []string{},
+		ComputedWeeks: []WeekPreview{},
+	}
+	if preview.Errors == nil {
+		preview.Errors = []ValidationError{}
+	}
+	jobNames := make(map[string]string, len(req.Jobs))
+	for _, job := range req.Jobs {
+		jobNames[job.JobNumber] = job.JobName
+	}
+	preview.Warnings = append(preview.Warnings, holidayWarnings(req)...)
+	if start, err := time.Parse(time.RFC3339, req.WeekStartDate); err == nil && start.Weekday() != weekStartDay(req) {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("week_start_date %s is a %s, not a %s", start.Format(dateLayout), start.Weekday(), weekStartDay(req)))
+	}
+	unknownJobs := map[string]bool{}
+	for _, week := range timecardWeeks(req) {
+		weekStart, err := time.Parse(time.RFC3339, week.WeekStartDate)
+		if err != nil {
+			continue // already reported by validateTimecardRequest
+		}
+		weekEnd := weekStart.AddDate(0, 0, 7)
+		label := week.WeekLabel
+		if label == "" {
+			label = fmt.Sprintf("Week %d", week.WeekNumber)
+		}
+		for _, section := range sheetLayout.sections() {
+			if n := len(getSectionColumns(week.Entries, sheetLayout, section.Name)); n > len(labourCodeColumns) {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s has %d %s columns; only the first %d fit on the sheet", label, n, section.Name, len(labourCodeColumns)))
+			}
+		}
+		weekPreview := WeekPreview{
+			WeekNumber:    week.WeekNumber,
+			WeekLabel:     label,
+			WeekStartDate: week.WeekStartDate,
+			Jobs:          []JobPreview{},
+		}
+		byJob := map[string]*JobPreview{}
+		var order []string
+		for _, entry := range week.Entries {
+			date, err := time.Parse(time.RFC3339, entry.Date)
+			if err != nil {
+				continue
+			}
+			if date.Before(weekStart) || !date.Before(weekEnd) {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s: entry on %s is outside the week and will not appear", label, date.Format(dateLayout)))
+				continue
+			}
+			jobNumber := strings.TrimSpace(entry.JobNumber)
+			if _, ok := jobNames[jobNumber]; !ok && !unknownJobs[jobNumber] {
+				unknownJobs[jobNumber] = true
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf("job %q is not in the job list", jobNumber))
+			}
+			job := byJob[jobNumber]
+			if job == nil {
+				job = &JobPreview{JobNumber: jobNumber, JobName: jobNames[jobNumber]}
+				byJob[jobNumber] = job
+				order = append(order, jobNumber)
+			}
+			switch {
+			case entry.Overtime:
+				job.OvertimeHours += entry.Hours
+			case entry.IsNightShift:
+				job.NightHours += entry.Hours
+			default:
+				job.RegularHours += entry.Hours
+			}
+			job.TotalHours += entry.Hours
+		}
+		for _, jobNumber := range order {
+			weekPreview.Jobs = append(weekPreview.Jobs, *byJob[jobNumber])
+		}
+		preview.ComputedWeeks = append(preview.ComputedWeeks, weekPreview)
+	}
+	return preview
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiVersion is the current route version; routes are served under /v1/.
+const apiVersion = "1"
+
+// GitCommit and BuildTime are set at build time:
+//
+//	go build -ldflags "-X main.GitCommit=<sha> -X main.BuildTime=<rfc3339>"
+var (
+	GitCommit = ""
+	BuildTime = ""
+)
+
+// deprecatedAlias serves an unversioned legacy path while pointing clients at its
+// /v1 successor via Deprecation and Link headers.
+func deprecatedAlias(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "</v"+apiVersion+r.URL.Path+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// splitRoutePattern splits a ServeMux pattern such as "GET /api/jobs/{id}" into
+// its method prefix ("GET ", or "" for any method) and path.
+func splitRoutePattern(pattern string) (method, path string) {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		return method + " ", path
+	}
+	return "", pattern
+}
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, APIError{Code: ErrMethodNotAllowed, Message: "Method not allowed"})
+		return
+	}
+	commit := GitCommit
+	if commit == "" {
+		commit = os.Getenv("RENDER_GIT_COMMIT")
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	buildTime := BuildTime
+	if buildTime == "" {
+		buildTime = "unknown"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"version":    apiVersion,
+		"git_commit": commit,
+		"build_time": buildTime,
+	})
+}